@@ -0,0 +1,319 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Admin API defaults.
+const (
+	defaultAdminAllowedIPs = "127.0.0.1/32,::1/128"
+	defaultAdminTopClients = 20
+	maxAdminTopClients     = 500
+	redactedValue          = "[REDACTED]"
+)
+
+// adminConfig is the effective server configuration exposed by the admin API.
+// Secrets are redacted before they are placed here.
+type adminConfig struct {
+	Port              string   `json:"port"`
+	ClientID          string   `json:"client_id"`
+	ClientSecret      string   `json:"client_secret"`
+	RedirectURI       string   `json:"redirect_uri"`
+	AllowedOrigins    string   `json:"allowed_origins"`
+	BaseDomain        string   `json:"base_domain"`
+	WorkspaceMode     string   `json:"workspace_mode"`
+	AdminToken        string   `json:"admin_token"`
+	AdminAllowedIPs   []string `json:"admin_allowed_ips"`
+	RateLimitWindow   string   `json:"rate_limit_window"`
+	FailedLoginWindow string   `json:"failed_login_window"`
+	AppID             int      `json:"app_id"`
+	RateLimitRequests int      `json:"rate_limit_requests"`
+	MaxFailedLogins   int      `json:"max_failed_logins"`
+}
+
+// clientCount is the number of recent events recorded for a client IP.
+type clientCount struct {
+	Last  time.Time `json:"last"`
+	IP    string    `json:"ip"`
+	Count int       `json:"count"`
+}
+
+// adminServer serves the /admin namespace for inspecting runtime security state.
+type adminServer struct {
+	config    adminConfig
+	allowed   []netip.Prefix
+	tokenHash [sha256.Size]byte
+}
+
+// redact hides a secret value while still showing whether it is set.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// parseIPAllowlist parses a comma-separated list of IPs or CIDR prefixes.
+func parseIPAllowlist(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for entry := range strings.SplitSeq(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// newAdminServer creates the admin API. It returns nil if no admin token is configured,
+// which keeps the admin namespace disabled.
+func newAdminServer(token, allowedIPs string, config adminConfig) (*adminServer, error) {
+	if token == "" {
+		return nil, nil //nolint:nilnil // a nil server means the admin API is disabled
+	}
+	if len(token) < 32 {
+		return nil, fmt.Errorf("admin token must be at least 32 characters, got %d", len(token))
+	}
+	allowed, err := parseIPAllowlist(allowedIPs)
+	if err != nil {
+		return nil, err
+	}
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("admin IP allowlist is empty")
+	}
+
+	config.AdminToken = redact(token)
+	config.AdminAllowedIPs = make([]string, len(allowed))
+	for i, p := range allowed {
+		config.AdminAllowedIPs[i] = p.String()
+	}
+
+	return &adminServer{
+		tokenHash: sha256.Sum256([]byte(token)),
+		allowed:   allowed,
+		config:    config,
+	}, nil
+}
+
+// handler returns the admin routes wrapped with IP allowlist and credential checks.
+func (a *adminServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/ratelimits", a.handleRateLimits)
+	mux.HandleFunc("GET /admin/failed-attempts", a.handleFailedAttempts)
+	mux.HandleFunc("GET /admin/authcodes", a.handleAuthCodes)
+	mux.HandleFunc("GET /admin/config", a.handleConfig)
+	mux.HandleFunc("DELETE /admin/clients/{ip}", a.handleClearClient)
+	mux.HandleFunc("GET /admin/maintenance", a.handleMaintenance)
+	mux.HandleFunc("PUT /admin/maintenance", a.handleSetMaintenance)
+	mux.HandleFunc("DELETE /admin/maintenance", a.handleEndMaintenance)
+	mux.Handle("GET /admin/metrics", metricsHandler())
+	return a.protect(mux)
+}
+
+// protect enforces the IP allowlist and admin bearer token on every admin request.
+func (a *adminServer) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+		if err != nil || !a.allowedAddr(addr.Unmap()) {
+			logFrom(r.Context()).Warn("Admin request from non-allowlisted IP", securityEvent, "path", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		hash := sha256.Sum256([]byte(token))
+		if !ok || subtle.ConstantTimeCompare(hash[:], a.tokenHash[:]) != 1 {
+			trackFailedAttempt(ip)
+			logFrom(r.Context()).Warn("Admin request with invalid credentials", securityEvent, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *adminServer) allowedAddr(addr netip.Addr) bool {
+	for _, p := range a.allowed {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (*adminServer) handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAdminTopClients
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAdminTopClients {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	exchangeRateLimiter.mu.Lock()
+	clients := topClients(exchangeRateLimiter.requests, time.Now().Add(-exchangeRateLimiter.window), limit)
+	exchangeRateLimiter.mu.Unlock()
+
+	writeAdminJSON(w, struct {
+		Window  string        `json:"window"`
+		Clients []clientCount `json:"clients"`
+		Limit   int           `json:"limit"`
+	}{
+		Window:  exchangeRateLimiter.window.String(),
+		Limit:   exchangeRateLimiter.limit,
+		Clients: clients,
+	})
+}
+
+func (*adminServer) handleFailedAttempts(w http.ResponseWriter, _ *http.Request) {
+	failedMutex.Lock()
+	clients := topClients(failedAttempts, time.Now().Add(-*failedLoginWindow), maxAdminTopClients)
+	failedMutex.Unlock()
+
+	writeAdminJSON(w, struct {
+		Window    string        `json:"window"`
+		Clients   []clientCount `json:"clients"`
+		Threshold int           `json:"threshold"`
+	}{
+		Window:    failedLoginWindow.String(),
+		Threshold: *maxFailedLogins,
+		Clients:   clients,
+	})
+}
+
+func (*adminServer) handleAuthCodes(w http.ResponseWriter, _ *http.Request) {
+	authCodesMutex.Lock()
+	pending := len(authCodes)
+	authCodesMutex.Unlock()
+
+	writeAdminJSON(w, struct {
+		Pending int `json:"pending"`
+	}{Pending: pending})
+}
+
+func (a *adminServer) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, a.config)
+}
+
+func (*adminServer) handleClearClient(w http.ResponseWriter, r *http.Request) {
+	// The IP must be given exactly as listed by the admin API (IPv6 keys keep their brackets)
+	ip := r.PathValue("ip")
+	if _, err := netip.ParseAddr(strings.Trim(ip, "[]")); err != nil {
+		http.Error(w, "Invalid IP", http.StatusBadRequest)
+		return
+	}
+
+	exchangeRateLimiter.mu.Lock()
+	_, limited := exchangeRateLimiter.requests[ip]
+	delete(exchangeRateLimiter.requests, ip)
+	exchangeRateLimiter.mu.Unlock()
+
+	failedMutex.Lock()
+	_, failed := failedAttempts[ip]
+	delete(failedAttempts, ip)
+	failedMutex.Unlock()
+
+	logFrom(r.Context()).Info("Admin cleared client counters", "client", ip, "rate_limit", limited, "failed_attempts", failed)
+	writeAdminJSON(w, struct {
+		IP                    string `json:"ip"`
+		RateLimitCleared      bool   `json:"rate_limit_cleared"`
+		FailedAttemptsCleared bool   `json:"failed_attempts_cleared"`
+	}{IP: ip, RateLimitCleared: limited, FailedAttemptsCleared: failed})
+}
+
+func (*adminServer) handleMaintenance(w http.ResponseWriter, _ *http.Request) {
+	writeAdminJSON(w, currentMaintenanceStatus(time.Now()))
+}
+
+// handleSetMaintenance starts or schedules a maintenance window. The body is a
+// maintenanceWindow; an empty object starts maintenance now until it is ended.
+func (*adminServer) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var window maintenanceWindow
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&window); err != nil {
+		http.Error(w, "Invalid maintenance window: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	if err := window.validate(now); err != nil {
+		http.Error(w, "Invalid maintenance window: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	setMaintenance(&window, "admin")
+	writeAdminJSON(w, currentMaintenanceStatus(now))
+}
+
+func (*adminServer) handleEndMaintenance(w http.ResponseWriter, _ *http.Request) {
+	setMaintenance(nil, "admin")
+	writeAdminJSON(w, currentMaintenanceStatus(time.Now()))
+}
+
+// topClients returns the clients with the most events after cutoff, busiest first.
+// Callers must hold the lock that guards events.
+func topClients(events map[string][]time.Time, cutoff time.Time, limit int) []clientCount {
+	clients := make([]clientCount, 0, len(events))
+	for ip, times := range events {
+		count := 0
+		var last time.Time
+		for _, t := range times {
+			if t.After(cutoff) {
+				count++
+				if t.After(last) {
+					last = t
+				}
+			}
+		}
+		if count > 0 {
+			clients = append(clients, clientCount{IP: ip, Count: count, Last: last})
+		}
+	}
+	slices.SortFunc(clients, func(a, b clientCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.IP, b.IP)
+	})
+	if len(clients) > limit {
+		clients = clients[:limit]
+	}
+	return clients
+}
+
+func writeAdminJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode admin response", "error", err)
+	}
+}
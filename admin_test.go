@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAdminToken = "admin-token-0123456789abcdefghijklmnop"
+
+func newTestAdmin(t *testing.T) http.Handler {
+	t.Helper()
+	exchangeRateLimiter = &rateLimiter{
+		requests: make(map[string][]time.Time),
+		limit:    *rateLimitRequests,
+		window:   *rateLimitWindow,
+	}
+	failedMutex.Lock()
+	failedAttempts = make(map[string][]time.Time)
+	failedMutex.Unlock()
+	setupAuthCodeStore(t)
+
+	admin, err := newAdminServer(testAdminToken, "127.0.0.1,10.0.0.0/8", adminConfig{
+		ClientID:     "client",
+		ClientSecret: redact("super-secret"),
+	})
+	if err != nil {
+		t.Fatalf("newAdminServer() error = %v", err)
+	}
+	return admin.handler()
+}
+
+func adminRequest(method, target, remoteAddr, token string) *http.Request {
+	req := httptest.NewRequest(method, target, http.NoBody)
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// TestAdminAccessControl verifies the IP allowlist and credential checks.
+func TestAdminAccessControl(t *testing.T) {
+	handler := newTestAdmin(t)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{name: "allowed ip and token", remoteAddr: "127.0.0.1:1234", token: testAdminToken, want: http.StatusOK},
+		{name: "allowed cidr", remoteAddr: "10.1.2.3:1234", token: testAdminToken, want: http.StatusOK},
+		{name: "missing token", remoteAddr: "127.0.0.1:1234", want: http.StatusUnauthorized},
+		{name: "wrong token", remoteAddr: "127.0.0.1:1234", token: "wrong", want: http.StatusUnauthorized},
+		{name: "ip not allowlisted", remoteAddr: "192.0.2.1:1234", token: testAdminToken, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, adminRequest(http.MethodGet, "/admin/authcodes", tt.remoteAddr, tt.token))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestAdminConfigRedactsSecrets verifies secrets never appear in the config dump.
+func TestAdminConfigRedactsSecrets(t *testing.T) {
+	handler := newTestAdmin(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, adminRequest(http.MethodGet, "/admin/config", "127.0.0.1:1234", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{"super-secret", testAdminToken} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config dump contains secret %q", secret)
+		}
+	}
+	if !strings.Contains(body, redactedValue) {
+		t.Errorf("config dump = %s, want redacted values", body)
+	}
+}
+
+// TestAdminRateLimitsAndClear verifies listing and clearing a client's counters.
+func TestAdminRateLimitsAndClear(t *testing.T) {
+	handler := newTestAdmin(t)
+
+	now := time.Now()
+	exchangeRateLimiter.requests["192.0.2.10"] = []time.Time{now, now, now}
+	exchangeRateLimiter.requests["192.0.2.20"] = []time.Time{now}
+	trackFailedAttempt("192.0.2.10")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, adminRequest(http.MethodGet, "/admin/ratelimits?limit=1", "127.0.0.1:1234", testAdminToken))
+	var got struct {
+		Clients []clientCount `json:"clients"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got.Clients) != 1 || got.Clients[0].IP != "192.0.2.10" || got.Clients[0].Count != 3 {
+		t.Fatalf("top clients = %+v, want 192.0.2.10 with 3 requests", got.Clients)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, adminRequest(http.MethodDelete, "/admin/clients/192.0.2.10", "127.0.0.1:1234", testAdminToken))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("clear status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if _, ok := exchangeRateLimiter.requests["192.0.2.10"]; ok {
+		t.Error("rate limit entry was not cleared")
+	}
+	failedMutex.Lock()
+	_, failed := failedAttempts["192.0.2.10"]
+	failedMutex.Unlock()
+	if failed {
+		t.Error("failed attempts entry was not cleared")
+	}
+}
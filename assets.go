@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"net/http"
+	pathpkg "path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Assets smaller than this are not worth compressing.
+const minCompressSize = 512
+
+// Content encodings supported for precompressed assets.
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingIdentity = "identity"
+)
+
+// Length of the content hash embedded in fingerprinted asset names.
+const fingerprintLen = 10
+
+// staticRoots are the files and directories served from the static filesystem.
+var staticRoots = []string{"index.html", "assets"}
+
+var (
+	// jsImportPattern matches relative ES module specifiers in import/export statements.
+	jsImportPattern = regexp.MustCompile(`((?:\bfrom|\bimport)\s*\(?\s*["'])\./([\w-]+\.js)(["'])`)
+
+	// htmlAssetPattern matches asset URLs in HTML attributes, with an optional origin and
+	// a legacy ?v= cache-busting parameter.
+	htmlAssetPattern = regexp.MustCompile(`(["'])((?:https://[\w.-]+)?/assets/)([\w.-]+)(?:\?v=[^"']*)?(["'])`)
+
+	// htmlTagPattern matches a single HTML start tag.
+	htmlTagPattern = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+
+	// sriTagPattern matches the tags whose subresources browsers verify with integrity.
+	sriTagPattern = regexp.MustCompile(`^<(?:script\b|link\b[^>]*\brel="(?:stylesheet|modulepreload|preload)")`)
+
+	// hashedNamePattern matches a fingerprinted file name such as app.0123456789.js.
+	hashedNamePattern = regexp.MustCompile(`^(.+)\.[0-9a-f]{10}(\.[a-z0-9]+)$`)
+)
+
+// staticAsset is an embedded file prepared once at startup for serving.
+type staticAsset struct {
+	encoded     map[string][]byte // precompressed variants keyed by content encoding
+	contentType string
+	etag        string // strong ETag of the identity representation
+	hashedName  string // fingerprinted path, empty for files served only under their own name
+	data        []byte
+}
+
+// assetStore holds every embedded file keyed by its path in the embed FS.
+type assetStore struct {
+	modTime time.Time
+	assets  map[string]*staticAsset
+	hashed  map[string]string // fingerprinted path -> embed FS path
+}
+
+// newAssetStore reads the static roots in fsys, fingerprints files under assets/ by
+// content hash, rewrites references to them in HTML and ES module imports, and
+// optionally precompresses the results.
+func newAssetStore(fsys fs.FS, compress bool) (*assetStore, error) {
+	files := make(map[string][]byte)
+	for _, root := range staticRoots {
+		err := fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+			files[name] = data
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fp := &fingerprinter{
+		files:    files,
+		names:    make(map[string]string),
+		visiting: make(map[string]bool),
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if strings.HasPrefix(name, "assets/") {
+			if _, err := fp.resolve(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, data := range files {
+		if strings.HasSuffix(name, ".html") {
+			rewritten, err := fp.rewriteHTML(name, data)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = rewritten
+		}
+	}
+
+	store := &assetStore{
+		assets:  make(map[string]*staticAsset),
+		hashed:  make(map[string]string),
+		modTime: time.Now().UTC().Truncate(time.Second),
+	}
+	for name, data := range files {
+		asset, err := newStaticAsset(name, data, compress)
+		if err != nil {
+			return nil, fmt.Errorf("prepare %s: %w", name, err)
+		}
+		if hashedName, ok := fp.names[name]; ok {
+			asset.hashedName = hashedName
+			store.hashed[hashedName] = name
+		}
+		store.assets[name] = asset
+	}
+	return store, nil
+}
+
+// fingerprinter assigns content-hash names to assets. A module's hash covers its
+// rewritten imports, so changing a dependency changes the hash of every importer.
+type fingerprinter struct {
+	files    map[string][]byte
+	names    map[string]string // embed FS path -> fingerprinted path
+	visiting map[string]bool
+}
+
+// resolve rewrites the imports of name, then fingerprints its final contents.
+func (fp *fingerprinter) resolve(name string) (string, error) {
+	if hashedName, ok := fp.names[name]; ok {
+		return hashedName, nil
+	}
+	if fp.visiting[name] {
+		return "", fmt.Errorf("import cycle through %s", name)
+	}
+	fp.visiting[name] = true
+	defer delete(fp.visiting, name)
+
+	data := fp.files[name]
+	if strings.HasSuffix(name, ".js") {
+		var resolveErr error
+		dir := pathpkg.Dir(name)
+		data = jsImportPattern.ReplaceAllFunc(data, func(m []byte) []byte {
+			sub := jsImportPattern.FindSubmatch(m)
+			dep := pathpkg.Join(dir, string(sub[2]))
+			if _, ok := fp.files[dep]; !ok {
+				resolveErr = fmt.Errorf("%s imports %s which is not embedded", name, dep)
+				return m
+			}
+			hashedDep, err := fp.resolve(dep)
+			if err != nil {
+				resolveErr = err
+				return m
+			}
+			return slices.Concat(sub[1], []byte("./"+pathpkg.Base(hashedDep)), sub[3])
+		})
+		if resolveErr != nil {
+			return "", resolveErr
+		}
+		fp.files[name] = data
+	}
+
+	sum := sha256.Sum256(data)
+	ext := pathpkg.Ext(name)
+	hashedName := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:])[:fingerprintLen] + ext
+	fp.names[name] = hashedName
+	return hashedName, nil
+}
+
+// rewriteHTML points our asset URLs in an HTML file at their fingerprinted names and
+// adds Subresource Integrity attributes to the scripts and stylesheets it loads.
+// It fails if the HTML refers to an asset that does not exist.
+func (fp *fingerprinter) rewriteHTML(name string, data []byte) ([]byte, error) {
+	var rewriteErr error
+	data = htmlTagPattern.ReplaceAllFunc(data, func(tag []byte) []byte {
+		var integrity string
+		tag = htmlAssetPattern.ReplaceAllFunc(tag, func(m []byte) []byte {
+			sub := htmlAssetPattern.FindSubmatch(m)
+			if !isOwnOrigin(string(sub[2])) {
+				return m
+			}
+			asset := "assets/" + string(sub[3])
+			hashedName, ok := fp.names[asset]
+			if !ok {
+				rewriteErr = fmt.Errorf("%s refers to %s which is not embedded", name, asset)
+				return m
+			}
+			if ext := pathpkg.Ext(asset); ext == ".js" || ext == ".css" {
+				integrity = subresourceIntegrity(fp.files[asset])
+			}
+			return slices.Concat(sub[1], []byte(ownAssetPrefix(string(sub[2]))), []byte(pathpkg.Base(hashedName)), sub[4])
+		})
+		if integrity == "" || !sriTagPattern.Match(tag) || bytes.Contains(tag, []byte("integrity=")) {
+			return tag
+		}
+		attrs := ` integrity="` + integrity + `"`
+		if !bytes.Contains(tag, []byte("crossorigin")) {
+			attrs += ` crossorigin="anonymous"`
+		}
+		end := len(tag) - 1
+		if bytes.HasSuffix(tag, []byte(" />")) {
+			end -= 2
+		}
+		return slices.Concat(tag[:end], []byte(attrs), tag[end:])
+	})
+	return data, rewriteErr
+}
+
+// subresourceIntegrity returns the SHA-384 integrity metadata for data.
+func subresourceIntegrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// isOwnOrigin reports whether an asset URL prefix such as "https://ready-to-review.dev/assets/"
+// points at this server. Relative prefixes always do. The embedded HTML refers to
+// the default domain, so that counts as ours when serving another base domain.
+func isOwnOrigin(prefix string) bool {
+	origin, ok := strings.CutSuffix(prefix, "/assets/")
+	if !ok || origin == "" {
+		return ok
+	}
+	host := strings.TrimPrefix(origin, "https://")
+	return isOurHost(host) || host == defaultBaseDomain || strings.HasSuffix(host, "."+defaultBaseDomain)
+}
+
+// ownAssetPrefix moves an absolute asset URL prefix of ours to the base domain.
+func ownAssetPrefix(prefix string) string {
+	if !strings.HasPrefix(prefix, "https://") {
+		return prefix
+	}
+	return "https://" + *baseDomain + "/assets/"
+}
+
+func newStaticAsset(name string, data []byte, compress bool) (*staticAsset, error) {
+	sum := sha256.Sum256(data)
+	asset := &staticAsset{
+		data:        data,
+		contentType: contentTypeFor(name),
+		etag:        `"` + hex.EncodeToString(sum[:16]) + `"`,
+		encoded:     make(map[string][]byte),
+	}
+
+	if !compress || len(data) < minCompressSize || !isCompressible(asset.contentType) {
+		return asset, nil
+	}
+
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := bw.Write(data); err != nil {
+		return nil, fmt.Errorf("brotli: %w", err)
+	}
+	if err := bw.Close(); err != nil {
+		return nil, fmt.Errorf("brotli: %w", err)
+	}
+	if buf.Len() < len(data) {
+		asset.encoded[encodingBrotli] = bytes.Clone(buf.Bytes())
+	}
+
+	buf.Reset()
+	gw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if _, err := gw.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if buf.Len() < len(data) {
+		asset.encoded[encodingGzip] = bytes.Clone(buf.Bytes())
+	}
+
+	return asset, nil
+}
+
+// lookup returns the asset for a request path. immutable is true only when the path is
+// the asset's current fingerprinted name, so the response may be cached forever.
+// Unhashed names and stale fingerprints resolve to the current content.
+func (s *assetStore) lookup(name string) (asset *staticAsset, immutable, ok bool) {
+	if canonical, found := s.hashed[name]; found {
+		return s.assets[canonical], true, true
+	}
+	if asset, found := s.assets[name]; found {
+		return asset, false, true
+	}
+	if m := hashedNamePattern.FindStringSubmatch(name); m != nil {
+		if asset, found := s.assets[m[1]+m[2]]; found && asset.hashedName != "" {
+			return asset, false, true
+		}
+	}
+	return nil, false, false
+}
+
+// serve writes the asset using the best encoding the client accepts.
+// http.ServeContent handles HEAD, Range and conditional requests.
+func (s *assetStore) serve(w http.ResponseWriter, r *http.Request, name string, asset *staticAsset) {
+	h := w.Header()
+	if asset.contentType != "" {
+		h.Set("Content-Type", asset.contentType)
+	}
+
+	data := asset.data
+	etag := asset.etag
+	if len(asset.encoded) > 0 {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	encoding, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"), asset.encoded)
+	if !ok {
+		h.Del("Content-Type")
+		http.Error(w, "No acceptable content coding", http.StatusNotAcceptable)
+		return
+	}
+	if encoding != encodingIdentity {
+		data = asset.encoded[encoding]
+		// Each representation needs its own strong validator
+		etag = strings.TrimSuffix(asset.etag, `"`) + "-" + encoding + `"`
+		h.Set("Content-Encoding", encoding)
+	}
+	h.Set("ETag", etag)
+
+	counter := &countingWriter{ResponseWriter: w}
+	http.ServeContent(counter, r, name, s.modTime, bytes.NewReader(data))
+	staticBytesServed.WithLabelValues(encoding).Add(float64(counter.n))
+}
+
+// negotiateEncoding picks the preferred available encoding from an
+// Accept-Encoding header as RFC 9110 section 12.5.3 describes: "*" stands for
+// every coding the header does not name, and identity is acceptable unless
+// refused by "identity;q=0" or by "*;q=0" without an identity entry. Brotli
+// wins ties over gzip since it is smaller for text assets. ok is false when
+// no representation is acceptable.
+func negotiateEncoding(header string, available map[string][]byte) (encoding string, ok bool) {
+	weights := make(map[string]float64)
+	for part := range strings.SplitSeq(header, ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if enc == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		weights[enc] = q
+	}
+	weight := func(enc string) (float64, bool) {
+		if q, ok := weights[enc]; ok {
+			return q, true
+		}
+		q, ok := weights["*"]
+		return q, ok
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range []string{encodingBrotli, encodingGzip} {
+		if _, ok := available[enc]; !ok {
+			continue
+		}
+		if q, _ := weight(enc); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	// Unless the header weighs it, identity is the fallback when no coding
+	// is acceptable
+	identityQ, weighed := weight(encodingIdentity)
+	switch {
+	case weighed && identityQ > bestQ:
+		return encodingIdentity, true
+	case best != "":
+		return best, true
+	case !weighed:
+		return encodingIdentity, true
+	}
+	return "", false
+}
+
+// contentTypeFor returns the Content-Type for a file based on its extension.
+func contentTypeFor(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".html"):
+		return "text/html; charset=utf-8"
+	case strings.HasSuffix(name, ".css"):
+		return "text/css; charset=utf-8"
+	case strings.HasSuffix(name, ".js"):
+		return "application/javascript; charset=utf-8"
+	case strings.HasSuffix(name, ".json"):
+		return "application/json; charset=utf-8"
+	case strings.HasSuffix(name, ".png"):
+		return "image/png"
+	case strings.HasSuffix(name, ".jpg"), strings.HasSuffix(name, ".jpeg"):
+		return "image/jpeg"
+	case strings.HasSuffix(name, ".svg"):
+		return "image/svg+xml"
+	case strings.HasSuffix(name, ".ico"):
+		return "image/x-icon"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// url returns the URL path for an embedded file, using its fingerprinted name if it has one.
+func (s *assetStore) url(name string) string {
+	if asset, ok := s.assets[name]; ok && asset.hashedName != "" {
+		return "/" + asset.hashedName
+	}
+	return "/" + name
+}
+
+// isCompressible reports whether a content type benefits from compression.
+func isCompressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.HasPrefix(contentType, "application/javascript") ||
+		strings.HasPrefix(contentType, "application/json") ||
+		strings.HasPrefix(contentType, "image/svg+xml") ||
+		strings.HasPrefix(contentType, "image/x-icon")
+}
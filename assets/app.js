@@ -24,7 +24,7 @@ const App = (() => {
 
   // Parse URL to get viewing context
   const parseURL = () => {
-    let path = window.location.pathname;
+    let path = Workspace.path();
 
     // Remove trailing slash to normalize paths
     path = path.replace(/\/$/, "");
@@ -203,28 +203,28 @@ const App = (() => {
 
     // All links use new format without org in path (org is in subdomain)
     if (dashboardLink && targetUsername) {
-      dashboardLink.href = `/u/${targetUsername}`;
+      dashboardLink.href = Workspace.link(`/u/${targetUsername}`);
     }
 
     if (statsLink) {
-      statsLink.href = "/stats";
+      statsLink.href = Workspace.link("/stats");
     }
 
     if (settingsLink) {
-      settingsLink.href = "/robots";
+      settingsLink.href = Workspace.link("/robots");
     }
 
     if (notificationsLink) {
-      notificationsLink.href = "/notifications";
+      notificationsLink.href = Workspace.link("/notifications");
     }
 
     if (changelogLink) {
       // Always default to org-wide changelog
-      changelogLink.href = "/changelog";
+      changelogLink.href = Workspace.link("/changelog");
     }
 
     if (leaderboardLink) {
-      leaderboardLink.href = "/leaderboard";
+      leaderboardLink.href = Workspace.link("/leaderboard");
     }
   };
 
@@ -275,7 +275,7 @@ const App = (() => {
     updateHamburgerMenuLinks();
 
     // Set active states based on current path
-    const path = window.location.pathname;
+    const path = Workspace.path();
     if (dashboardLink) {
       if (path === "/" || path.startsWith("/u/")) {
         dashboardLink.classList.add("active");
@@ -575,7 +575,7 @@ const App = (() => {
     const urlContext = parseURL();
     if (!urlContext || !urlContext.username) {
       // biome-ignore lint/correctness/noUndeclaredVariables: DEMO_DATA loaded as global from demo-data.js
-      window.location.href = `/u/${DEMO_DATA.user.login}?demo=true`;
+      window.location.href = Workspace.link(`/u/${DEMO_DATA.user.login}?demo=true`);
       return;
     }
 
@@ -623,7 +623,7 @@ const App = (() => {
   // Manage search input visibility based on current page
   const updateSearchInputVisibility = () => {
     const searchInput = $("searchInput");
-    const path = window.location.pathname;
+    const path = Workspace.path();
 
     // Show search input only on PR view and robot army pages
     if (
@@ -718,7 +718,7 @@ const App = (() => {
       return;
     }
     // Handle notifications page routing
-    const path = window.location.pathname;
+    const path = Workspace.path();
     if (path === "/notifications" || path.match(/^\/notifications\/gh\/[^/]+$/)) {
       updateSearchInputVisibility();
       const token = Auth.getStoredToken();
@@ -741,7 +741,7 @@ const App = (() => {
       const token = Auth.getStoredToken();
       if (!token) {
         showToast("Please login to configure Robot Army", "error");
-        window.location.href = "/";
+        window.location.href = Workspace.link("/");
         return;
       }
 
@@ -751,7 +751,7 @@ const App = (() => {
         } catch (error) {
           console.error("Failed to load user:", error);
           showToast("Failed to load user data", "error");
-          window.location.href = "/";
+          window.location.href = Workspace.link("/");
           return;
         }
       }
@@ -914,7 +914,7 @@ const App = (() => {
 
       // If at root URL, redirect to user's page
       if (!urlContext && state.currentUser) {
-        window.location.href = `/u/${state.currentUser.login}`;
+        window.location.href = Workspace.link(`/u/${state.currentUser.login}`);
         return;
       }
 
@@ -956,7 +956,7 @@ const App = (() => {
       showMainContent();
 
       if (urlRedirect) {
-        window.history.replaceState({}, "", urlRedirect);
+        window.history.replaceState({}, "", Workspace.link(urlRedirect));
       }
     } catch (error) {
       console.error("Initialization error:", error);
@@ -1030,3 +1030,11 @@ if (document.readyState === "loading") {
 } else {
   App.init();
 }
+
+// Register the service worker that keeps the dashboard shell available offline.
+// Skipped over plain HTTP (--dev) so cached files never mask live reloads.
+if ("serviceWorker" in navigator && window.location.protocol === "https:") {
+  navigator.serviceWorker.register("/sw.js").catch((error) => {
+    console.error("[App] Service worker registration failed:", error);
+  });
+}
@@ -1,4 +1,5 @@
 // Authentication Module for Ready To Review
+import { Workspace } from "./workspace.js";
 console.log("[Auth Module] Loading...");
 
 // Log URL parameters on page load for debugging OAuth flow (without exposing secrets)
@@ -20,7 +21,6 @@ export const Auth = (() => {
     API_BASE: "https://api.github.com",
     STORAGE_KEY: "github_token",
     COOKIE_KEY: "github_pat",
-    OAUTH_REDIRECT_URI: "https://auth.ready-to-review.dev/oauth/callback",
   };
 
   // Cookie Functions
@@ -79,12 +79,12 @@ export const Auth = (() => {
     console.log("[Auth.initiateOAuthLogin] Current URL:", window.location.href);
     console.log(
       "[Auth.initiateOAuthLogin] Redirecting to:",
-      `${window.location.origin}/oauth/login`
+      `${window.location.origin}${Workspace.loginURL()}`
     );
 
     // Simply redirect to the backend OAuth endpoint
     // The backend will handle state generation and cookie management
-    window.location.href = "/oauth/login";
+    window.location.href = Workspace.loginURL();
   };
 
   const showGitHubAppModal = () => {
@@ -256,13 +256,13 @@ export const Auth = (() => {
 
   const handleAuthError = () => {
     clearToken();
-    const currentUrl = window.location.pathname + window.location.search;
-    window.location.href = `/?redirect=${encodeURIComponent(currentUrl)}`;
+    const currentUrl = Workspace.path() + window.location.search;
+    window.location.href = Workspace.link(`/?redirect=${encodeURIComponent(currentUrl)}`);
   };
 
   const logout = () => {
     clearToken();
-    window.location.href = "/";
+    window.location.href = Workspace.link("/");
   };
 
   // API function with auth headers
@@ -1,6 +1,7 @@
 import { Auth } from "./auth.js";
 // Changelog Module - Displays merged PRs from the last week
 import { $, $$, clearChildren, el, escapeHtml, hide, show, showToast } from "./utils.js";
+import { Workspace } from "./workspace.js";
 
 export const Changelog = (() => {
   const WEEK_IN_MS = 7 * 24 * 60 * 60 * 1000;
@@ -711,7 +712,7 @@ export const Changelog = (() => {
       // Show org link only when viewing a specific user in an org
       if (username && org) {
         show(changelogOrgLink);
-        changelogOrgLinkAnchor.href = `https://${org}.ready-to-review.dev/changelog`;
+        changelogOrgLinkAnchor.href = Workspace.workspaceURL(org, "/changelog");
       } else {
         hide(changelogOrgLink);
       }
@@ -807,7 +808,7 @@ export const Changelog = (() => {
         if (user) params.set("user", user);
         if (team) params.set("team", team);
         const newURL = `/changelog${params.toString() ? "?" + params.toString() : ""}`;
-        window.history.pushState({}, "", newURL);
+        window.history.pushState({}, "", Workspace.link(newURL));
       };
 
       // Define all the functions before using them
@@ -1,6 +1,7 @@
 import { Stats } from "./stats.js";
 // Leaderboard Module - Shows PR merge activity by contributor
 import { $, $$, hide, show, showToast } from "./utils.js";
+import { Workspace } from "./workspace.js";
 
 export const Leaderboard = (() => {
   const TEN_DAYS_IN_MS = 10 * 24 * 60 * 60 * 1000;
@@ -84,7 +85,7 @@ export const Leaderboard = (() => {
       } catch (error) {
         console.error("Failed to load current user:", error);
         showToast("Please login to view leaderboard", "error");
-        window.location.href = "/";
+        window.location.href = Workspace.link("/");
         return;
       }
     }
@@ -1,5 +1,6 @@
 // Robot Army Module for Ready To Review
 import { $, hide, show } from "./utils.js";
+import { Workspace } from "./workspace.js";
 
 export const Robots = (() => {
   const robotDefinitions = [
@@ -220,9 +221,9 @@ export const Robots = (() => {
         const urlContext = parseURL();
         const org = urlContext?.org || orgSelect?.value;
         if (org && org !== "*") {
-          window.location.href = `https://${org}.ready-to-review.dev/robots`;
+          window.location.href = Workspace.workspaceURL(org, "/robots");
         } else {
-          window.location.href = `/robots`;
+          window.location.href = Workspace.link("/robots");
         }
       };
     }
@@ -286,7 +287,7 @@ export const Robots = (() => {
     _loadUserOrganizations,
     parseURL
   ) => {
-    console.log("[showSettingsPage] Starting with path:", window.location.pathname);
+    console.log("[showSettingsPage] Starting with path:", Workspace.path());
     try {
       // Check for authentication first
       if (!state.accessToken) {
@@ -494,9 +495,9 @@ export const Robots = (() => {
   const onOrgSelected = (e) => {
     selectedOrg = e.target.value;
     if (!selectedOrg || selectedOrg === "*") {
-      window.location.href = `/robots`;
+      window.location.href = Workspace.link("/robots");
     } else {
-      window.location.href = `https://${selectedOrg}.ready-to-review.dev/robots`;
+      window.location.href = Workspace.workspaceURL(selectedOrg, "/robots");
     }
   };
 
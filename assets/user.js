@@ -773,7 +773,7 @@ export const User = (() => {
           });
 
           // On PR page, still merge in orgs from loaded PRs
-          const urlPath = window.location.pathname;
+          const urlPath = Workspace.path();
           if (urlPath === "/" || urlPath.startsWith("/u/")) {
             const prOrgs = new Set(orgs);
             const allPRs = [...state.pullRequests.incoming, ...state.pullRequests.outgoing];
@@ -1557,7 +1557,7 @@ export const User = (() => {
       }
     }
 
-    window.history.pushState({}, "", newPath);
+    window.history.pushState({}, "", Workspace.link(newPath));
 
     if (isStats) {
       loadStatsData();
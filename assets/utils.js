@@ -66,6 +66,11 @@ if (window.trustedTypes?.createPolicy) {
       // All user data MUST be escaped using escapeHtml() before passing to setHTML()
       return input;
     },
+    createScriptURL: (input) => {
+      // The service worker is the only script loaded from a string URL
+      if (input === "/sw.js") return input;
+      throw new TypeError(`Blocked untrusted script URL: ${input}`);
+    },
   });
 }
 
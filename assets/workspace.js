@@ -1,12 +1,36 @@
 // Workspace Module for Ready To Review
 console.log("[Workspace Module] Loading...");
+
+// Deployment settings come from the server so self-hosted domains work unchanged
+const loadConfig = async () => {
+  try {
+    const response = await fetch("/config.json", { credentials: "omit" });
+    if (!response.ok) throw new Error(`HTTP ${response.status}`);
+    return await response.json();
+  } catch (error) {
+    // Offline or served without the Go server: assume we're on the base domain
+    console.warn("[Workspace] Failed to load /config.json, using current host:", error);
+    return { base_domain: window.location.hostname, reserved_subdomains: [] };
+  }
+};
+const config = await loadConfig();
+
 export const Workspace = (() => {
   console.log("[Workspace Module] Initializing...");
 
-  const BASE_DOMAIN = "ready-to-review.dev";
+  const BASE_DOMAIN = config.base_domain;
+  const RESERVED_SUBDOMAINS = config.reserved_subdomains || [];
+  // Path mode serves workspaces from /w/{org}/ on a single host instead of subdomains
+  const PATH_MODE = config.workspace_mode === "path";
+  const WORKSPACE_PATH = /^\/w\/([A-Za-z0-9-]+)(?=\/|$)/;
 
-  // Extract workspace from hostname
+  // Extract workspace from hostname, or from the path in path mode
   const currentWorkspace = () => {
+    if (PATH_MODE) {
+      const match = window.location.pathname.match(WORKSPACE_PATH);
+      return match ? match[1] : null;
+    }
+
     const hostname = window.location.hostname;
 
     // Handle localhost - no workspace concept in development
@@ -19,12 +43,11 @@ export const Workspace = (() => {
       return null;
     }
 
-    const parts = hostname.split(".");
-
     // If subdomain exists and it's not a reserved one
-    if (parts.length >= 3) {
-      const subdomain = parts[0];
-      if (["www", "dash", "api", "login", "auth-callback"].includes(subdomain)) {
+    const suffix = `.${BASE_DOMAIN}`;
+    if (hostname.endsWith(suffix)) {
+      const subdomain = hostname.slice(0, -suffix.length);
+      if (subdomain.includes(".") || RESERVED_SUBDOMAINS.includes(subdomain)) {
         return null; // Base domain
       }
       return subdomain;
@@ -33,6 +56,34 @@ export const Workspace = (() => {
     return null; // Base domain
   };
 
+  // Current route within the workspace, without the /w/{org} prefix in path mode
+  const path = () => {
+    if (!PATH_MODE) return window.location.pathname;
+    return window.location.pathname.replace(WORKSPACE_PATH, "") || "/";
+  };
+
+  // Same-host link to a route in the current workspace
+  const link = (route) => {
+    const workspace = PATH_MODE ? currentWorkspace() : null;
+    return workspace ? `/w/${workspace}${route}` : route;
+  };
+
+  // URL of a path in an org workspace, or in the personal workspace if org is empty
+  const workspaceURL = (org, route) => {
+    if (PATH_MODE) {
+      return `${window.location.origin}${org ? `/w/${org}` : ""}${route}`;
+    }
+    const hostname = org ? `${org}.${BASE_DOMAIN}` : BASE_DOMAIN;
+    return `${window.location.protocol}//${hostname}${route}`;
+  };
+
+  // OAuth entry point. In path mode login happens on this host, so tell the
+  // server which workspace to come back to.
+  const loginURL = () => {
+    if (!PATH_MODE) return "/oauth/login";
+    return `/oauth/login?return_to=${encodeURIComponent(window.location.origin + link("/"))}`;
+  };
+
   // Get hidden orgs for current workspace
   const hiddenOrgs = () => {
     const workspace = currentWorkspace() || "personal";
@@ -99,22 +150,13 @@ export const Workspace = (() => {
 
   // Switch workspace (redirect to different subdomain, preserving current path)
   const switchWorkspace = (org) => {
-    const protocol = window.location.protocol;
-    const currentPath = window.location.pathname;
+    const currentPath = path();
     const currentSearch = window.location.search;
     const currentHash = window.location.hash;
 
-    let newHostname;
-    if (org === "" || org === "Personal" || org === null) {
-      // Personal workspace - no subdomain
-      newHostname = BASE_DOMAIN;
-    } else {
-      // Org workspace - use org as subdomain
-      newHostname = `${org}.${BASE_DOMAIN}`;
-    }
-
-    const newURL = `${protocol}//${newHostname}${currentPath}${currentSearch}${currentHash}`;
-    window.location.href = newURL;
+    // Personal workspace has no subdomain, org workspaces use the org as subdomain
+    const personal = org === "" || org === "Personal" || org === null;
+    window.location.href = workspaceURL(personal ? "" : org, `${currentPath}${currentSearch}${currentHash}`);
   };
 
   // Get username from cookie
@@ -142,6 +184,10 @@ export const Workspace = (() => {
     toggleOrgVisibility,
     isOrgHidden,
     switchWorkspace,
+    path,
+    link,
+    workspaceURL,
+    loginURL,
     username,
   };
   console.log("[Workspace Module] Exports:", workspaceExports);
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+)
+
+// embeddedAssets is built once because precompressing every file is slow.
+var embeddedAssets = sync.OnceValues(func() (*assetStore, error) {
+	return newAssetStore(staticFiles, true)
+})
+
+func setupStaticAssets(t *testing.T) {
+	t.Helper()
+	store, err := embeddedAssets()
+	if err != nil {
+		t.Fatalf("newAssetStore() error = %v", err)
+	}
+	staticAssets.Store(store)
+}
+
+func getStatic(t *testing.T, method, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, http.NoBody)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	serveStaticFiles(rec, req)
+	return rec
+}
+
+// TestStaticAssetEncodings verifies Accept-Encoding negotiation and precompressed bodies.
+func TestStaticAssetEncodings(t *testing.T) {
+	setupStaticAssets(t)
+	want := staticAssets.Load().assets["assets/app.js"].data
+	var err error
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		wantEncoding   string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{name: "identity", acceptEncoding: "", wantEncoding: ""},
+		{
+			name: "gzip", acceptEncoding: "gzip", wantEncoding: "gzip",
+			decode: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			name: "brotli preferred", acceptEncoding: "gzip, deflate, br", wantEncoding: "br",
+			decode: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		},
+		{
+			name: "brotli refused", acceptEncoding: "br;q=0, gzip;q=0.5", wantEncoding: "gzip",
+			decode: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{
+			name: "wildcard", acceptEncoding: "*", wantEncoding: "br",
+			decode: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		},
+		{
+			name: "wildcard after refusal", acceptEncoding: "br;q=0, *;q=0.5", wantEncoding: "gzip",
+			decode: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		},
+		{name: "identity preferred", acceptEncoding: "gzip;q=0.5, identity", wantEncoding: ""},
+		{name: "wildcard refused", acceptEncoding: "*;q=0, identity", wantEncoding: ""},
+		{
+			name: "identity refused", acceptEncoding: "identity;q=0, *;q=0.1", wantEncoding: "br",
+			decode: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := getStatic(t, http.MethodGet, "/assets/app.js?v=1", http.Header{"Accept-Encoding": {tt.acceptEncoding}})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+			var body io.Reader = rec.Body
+			if tt.decode != nil {
+				if body, err = tt.decode(body); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("read body: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("decoded body does not match embedded file")
+			}
+		})
+	}
+}
+
+// TestStaticAssetNotAcceptable verifies a 406 when the header refuses identity
+// and every available coding.
+func TestStaticAssetNotAcceptable(t *testing.T) {
+	setupStaticAssets(t)
+	for _, acceptEncoding := range []string{"identity;q=0", "*;q=0", "gzip;q=0, br;q=0, identity;q=0"} {
+		rec := getStatic(t, http.MethodGet, "/assets/app.js?v=1", http.Header{"Accept-Encoding": {acceptEncoding}})
+		if rec.Code != http.StatusNotAcceptable {
+			t.Errorf("Accept-Encoding %q: status = %d, want %d", acceptEncoding, rec.Code, http.StatusNotAcceptable)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q on a 406", acceptEncoding, got)
+		}
+	}
+}
+
+// TestStaticAssetConditionalRequests verifies ETag revalidation, Range and HEAD.
+func TestStaticAssetConditionalRequests(t *testing.T) {
+	setupStaticAssets(t)
+
+	first := getStatic(t, http.MethodGet, "/assets/styles.css", nil)
+	etag := first.Header().Get("ETag")
+	if etag == "" || etag[0] != '"' {
+		t.Fatalf("ETag = %q, want strong ETag", etag)
+	}
+	if first.Header().Get("Last-Modified") == "" {
+		t.Error("missing Last-Modified header")
+	}
+
+	notModified := getStatic(t, http.MethodGet, "/assets/styles.css", http.Header{"If-None-Match": {etag}})
+	if notModified.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d, want %d", notModified.Code, http.StatusNotModified)
+	}
+
+	gz := getStatic(t, http.MethodGet, "/assets/styles.css", http.Header{"Accept-Encoding": {"gzip"}})
+	if gz.Header().Get("ETag") == etag {
+		t.Error("gzip representation shares the identity ETag")
+	}
+
+	partial := getStatic(t, http.MethodGet, "/assets/styles.css", http.Header{"Range": {"bytes=0-9"}})
+	if partial.Code != http.StatusPartialContent || partial.Body.Len() != 10 {
+		t.Errorf("Range response = %d with %d bytes, want 206 with 10 bytes", partial.Code, partial.Body.Len())
+	}
+
+	head := getStatic(t, http.MethodHead, "/assets/styles.css", nil)
+	if head.Code != http.StatusOK || head.Body.Len() != 0 {
+		t.Errorf("HEAD response = %d with %d bytes, want 200 with empty body", head.Code, head.Body.Len())
+	}
+	if head.Header().Get("Content-Length") != first.Header().Get("Content-Length") {
+		t.Error("HEAD Content-Length differs from GET")
+	}
+}
+
+// TestStaticFingerprints verifies content-hash URLs, rewritten references and cache headers.
+func TestStaticFingerprints(t *testing.T) {
+	setupStaticAssets(t)
+
+	appURL := "/" + staticAssets.Load().assets["assets/app.js"].hashedName
+	utilsName := pathpkg.Base(staticAssets.Load().assets["assets/utils.js"].hashedName)
+
+	for _, target := range []string{"/", "/u/alice"} {
+		rec := getStatic(t, http.MethodGet, target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want %d", target, rec.Code, http.StatusOK)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, appURL+`"`) {
+			t.Errorf("GET %s does not reference %s", target, appURL)
+		}
+		if strings.Contains(body, "?v=") || strings.Contains(body, "/assets/app.js") {
+			t.Errorf("GET %s still references unhashed asset URLs", target)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("GET %s Cache-Control = %q, want no-cache", target, got)
+		}
+	}
+
+	app := getStatic(t, http.MethodGet, appURL, nil)
+	if got := app.Header().Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("hashed asset Cache-Control = %q, want immutable", got)
+	}
+	if !strings.Contains(app.Body.String(), `from "./`+utilsName+`"`) {
+		t.Errorf("app.js imports were not rewritten to %s", utilsName)
+	}
+
+	for _, target := range []string{"/assets/app.js", "/assets/app.0000000000.js"} {
+		rec := getStatic(t, http.MethodGet, target, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want %d", target, rec.Code, http.StatusOK)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("GET %s Cache-Control = %q, want no-cache", target, got)
+		}
+	}
+
+	if rec := getStatic(t, http.MethodGet, "/assets/missing.js", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing asset status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// TestFingerprintCoversDependencies verifies that changing a module changes the hash of its importers.
+func TestFingerprintCoversDependencies(t *testing.T) {
+	files := func(dep string) fstest.MapFS {
+		return fstest.MapFS{
+			"index.html":      {Data: []byte(`<script type="module" src="/assets/main.js"></script>`)},
+			"assets/main.js":  {Data: []byte(`import { dep } from "./dep.js";`)},
+			"assets/dep.js":   {Data: []byte(dep)},
+			"assets/other.js": {Data: []byte(`export const other = 1;`)},
+		}
+	}
+
+	before, err := newAssetStore(files("export const dep = 1;"), false)
+	if err != nil {
+		t.Fatalf("newAssetStore() error = %v", err)
+	}
+	after, err := newAssetStore(files("export const dep = 2;"), false)
+	if err != nil {
+		t.Fatalf("newAssetStore() error = %v", err)
+	}
+
+	for name, wantChanged := range map[string]bool{"assets/dep.js": true, "assets/main.js": true, "assets/other.js": false} {
+		changed := before.assets[name].hashedName != after.assets[name].hashedName
+		if changed != wantChanged {
+			t.Errorf("%s fingerprint changed = %v, want %v", name, changed, wantChanged)
+		}
+	}
+
+	cyclic := fstest.MapFS{
+		"index.html":  {Data: []byte(`<script type="module" src="/assets/a.js"></script>`)},
+		"assets/a.js": {Data: []byte(`import "./b.js";`)},
+		"assets/b.js": {Data: []byte(`import "./a.js";`)},
+	}
+	if _, err := newAssetStore(cyclic, false); err == nil {
+		t.Error("newAssetStore() with an import cycle succeeded, want error")
+	}
+}
+
+// TestSubresourceIntegrity verifies integrity attributes match the served bytes.
+func TestSubresourceIntegrity(t *testing.T) {
+	setupStaticAssets(t)
+	store := staticAssets.Load()
+	index := string(store.assets["index.html"].data)
+
+	for _, name := range []string{"assets/app.js", "assets/styles.css", "assets/demo-data.js"} {
+		asset := store.assets[name]
+		want := `/` + asset.hashedName + `" integrity="` + subresourceIntegrity(asset.data) + `" crossorigin="anonymous"`
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html missing integrity for %s", name)
+		}
+	}
+
+	missing := fstest.MapFS{
+		"index.html":    {Data: []byte(`<script src="https://ready-to-review.dev/assets/gone.js"></script>`)},
+		"assets/app.js": {Data: []byte(`export const app = 1;`)},
+	}
+	if _, err := newAssetStore(missing, false); err == nil || !strings.Contains(err.Error(), "assets/gone.js") {
+		t.Errorf("newAssetStore() with a missing asset error = %v, want error naming assets/gone.js", err)
+	}
+
+	foreign := fstest.MapFS{
+		"index.html":    {Data: []byte(`<script src="https://cdn.example.com/assets/lib.js"></script>`)},
+		"assets/app.js": {Data: []byte(`export const app = 1;`)},
+	}
+	if _, err := newAssetStore(foreign, false); err != nil {
+		t.Errorf("newAssetStore() with a third-party asset error = %v, want nil", err)
+	}
+}
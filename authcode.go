@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// authCodeKeySize is the AES-256 key size used to seal pending tokens.
+const authCodeKeySize = 32
+
+// tokenSealer encrypts GitHub tokens while they wait in the auth code store,
+// so a heap dump or debug endpoint never exposes them in plaintext.
+type tokenSealer struct {
+	aead cipher.AEAD
+}
+
+// newTokenSealer creates an AES-GCM sealer from a 32-byte key.
+func newTokenSealer(key []byte) (*tokenSealer, error) {
+	if len(key) != authCodeKeySize {
+		return nil, fmt.Errorf("auth code key must be %d bytes, got %d", authCodeKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create GCM: %w", err)
+	}
+	return &tokenSealer{aead: aead}, nil
+}
+
+// seal encrypts plaintext bound to the given auth code. The nonce is prepended
+// to the returned ciphertext.
+func (s *tokenSealer) seal(plaintext []byte, code string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(code)), nil
+}
+
+// open decrypts a value produced by seal for the same auth code.
+// Callers must wipe the returned buffer once they are done with it.
+func (s *tokenSealer) open(sealed []byte, code string) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n+s.aead.Overhead() {
+		return nil, errors.New("sealed token too short")
+	}
+	return s.aead.Open(nil, sealed[:n], sealed[n:], []byte(code))
+}
+
+// loadAuthCodeKey returns the key used to seal pending tokens. When several
+// instances share an auth code store they must share AUTH_CODE_KEY (base64,
+// 32 bytes); otherwise a random key is generated at process start.
+func loadAuthCodeKey() ([]byte, error) {
+	if value := os.Getenv("AUTH_CODE_KEY"); value != "" {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("decode AUTH_CODE_KEY: %w", err)
+		}
+		slog.Info("Using AUTH_CODE_KEY from environment variable")
+		return key, nil
+	}
+
+	key := make([]byte, authCodeKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate auth code key: %w", err)
+	}
+	return key, nil
+}
+
+// storeAuthCode seals the token and records a one-time auth code for it.
+func storeAuthCode(code, token, username, returnTo string, ttl time.Duration) error {
+	plaintext := []byte(token)
+	defer wipe(plaintext)
+
+	sealed, err := authCodeSealer.seal(plaintext, code)
+	if err != nil {
+		return err
+	}
+
+	authCodesMutex.Lock()
+	authCodes[code] = authCodeData{
+		sealedToken: sealed,
+		username:    username,
+		expiry:      time.Now().Add(ttl),
+		returnTo:    returnTo,
+		used:        false,
+	}
+	authCodesMutex.Unlock()
+	return nil
+}
+
+// tokenResponseJSON renders the exchange response without copying the token
+// into an intermediate string. GitHub tokens are restricted to [A-Za-z0-9_],
+// so no JSON escaping is needed for them.
+func tokenResponseJSON(token []byte, username string) ([]byte, error) {
+	for _, c := range token {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '_' {
+			return nil, errors.New("unexpected character in token")
+		}
+	}
+	name, err := json.Marshal(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(token) + len(name) + 32)
+	buf.WriteString(`{"token":"`)
+	buf.Write(token)
+	buf.WriteString(`","username":`)
+	buf.Write(name)
+	buf.WriteString("}\n")
+	return buf.Bytes(), nil
+}
+
+// wipe zeroes a buffer that held secret material.
+func wipe(b []byte) {
+	clear(b)
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// Where a setting's effective value came from, in order of precedence.
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+	sourceDerived = "derived"
+	sourceSecrets = "secret manager"
+)
+
+// setting is a flag that can also be set from the environment or the config file.
+// Its config file key is the flag name with underscores, e.g. rate_limit_window.
+// Settings without env are never read from the environment.
+type setting struct {
+	flag   string
+	env    string
+	secret bool
+}
+
+// settings lists every configurable flag. --config and --print-config are
+// command line only.
+var settings = []setting{
+	{flag: "port", env: "PORT"},
+	{flag: "app-id", env: "GITHUB_APP_ID"},
+	{flag: "client-id", env: "GITHUB_CLIENT_ID"},
+	{flag: "client-secret", env: "GITHUB_CLIENT_SECRET", secret: true},
+	{flag: "redirect-uri", env: "OAUTH_REDIRECT_URI"},
+	{flag: "allowed-origins", env: "ALLOWED_ORIGINS"},
+	{flag: "base-domain", env: "BASE_DOMAIN"},
+	{flag: "workspace-mode", env: "WORKSPACE_MODE"},
+	{flag: "allowed-hosts", env: "ALLOWED_HOSTS"},
+	{flag: "original-host-secret", env: "ORIGINAL_HOST_SECRET", secret: true},
+	// DEV is too commonly set to switch a production server to development mode
+	{flag: "dev"},
+	{flag: "assets-override", env: "ASSETS_OVERRIDE"},
+	{flag: "admin-token", env: "ADMIN_TOKEN", secret: true},
+	{flag: "admin-allowed-ips", env: "ADMIN_ALLOWED_IPS"},
+	{flag: "rate-limit-requests", env: "RATE_LIMIT_REQUESTS"},
+	{flag: "rate-limit-window", env: "RATE_LIMIT_WINDOW"},
+	{flag: "max-failed-logins", env: "MAX_FAILED_LOGINS"},
+	{flag: "failed-login-window", env: "FAILED_LOGIN_WINDOW"},
+	{flag: "http-timeout", env: "HTTP_TIMEOUT"},
+	{flag: "shutdown-timeout", env: "SHUTDOWN_TIMEOUT"},
+	{flag: "state-expiry", env: "STATE_EXPIRY"},
+	{flag: "tls", env: "TLS_MODE"},
+	{flag: "tls-cert", env: "TLS_CERT_FILE"},
+	{flag: "tls-key", env: "TLS_KEY_FILE"},
+	{flag: "http-port", env: "HTTP_PORT"},
+	{flag: "acme-email", env: "ACME_EMAIL"},
+	{flag: "acme-cache-dir", env: "ACME_CACHE_DIR"},
+	{flag: "acme-directory", env: "ACME_DIRECTORY"},
+	{flag: "acme-dns-hook", env: "ACME_DNS_HOOK"},
+	{flag: "egress-proxy", env: "EGRESS_PROXY"},
+	{flag: "egress-proxy-user", env: "EGRESS_PROXY_USER"},
+	{flag: "egress-proxy-password", env: "EGRESS_PROXY_PASSWORD", secret: true},
+	{flag: "egress-ca-file", env: "EGRESS_CA_FILE"},
+	{flag: "egress-allowed-hosts", env: "EGRESS_ALLOWED_HOSTS"},
+	{flag: "max-auth-requests", env: "MAX_AUTH_REQUESTS"},
+	{flag: "max-static-requests", env: "MAX_STATIC_REQUESTS"},
+	{flag: "state-snapshot", env: "STATE_SNAPSHOT"},
+	{flag: "state-snapshot-key", env: "STATE_SNAPSHOT_KEY", secret: true},
+	{flag: "maintenance", env: "MAINTENANCE"},
+	{flag: "maintenance-start", env: "MAINTENANCE_START"},
+	{flag: "maintenance-end", env: "MAINTENANCE_END"},
+	{flag: "maintenance-message", env: "MAINTENANCE_MESSAGE"},
+	{flag: "metrics-addr", env: "METRICS_ADDR"},
+	{flag: "log-level", env: "LOG_LEVEL"},
+}
+
+// configSource records where a setting's value came from. detail names the
+// environment variable or file.
+type configSource struct {
+	kind   string
+	detail string
+}
+
+func (s configSource) String() string {
+	if s.detail == "" {
+		return s.kind
+	}
+	return s.kind + " " + s.detail
+}
+
+// fileKey returns the config file key for a flag name.
+func fileKey(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// readConfigFile reads a flat YAML (.yaml, .yml) or TOML (.toml) file into
+// flag values keyed by flag name. Lists are joined with commas.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file type %q: use .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		name := strings.ReplaceAll(key, "_", "-")
+		s, err := configValueString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s %w", path, key, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+func configValueString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configValueString(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("has unsupported value %v: settings must be strings, numbers, booleans or lists", value)
+	}
+}
+
+// applyConfig layers the environment and config file under the flags set on
+// the command line, so the precedence is flag > env > file > default. It returns
+// where each setting's value came from.
+func applyConfig(fs *flag.FlagSet, settings []setting, file map[string]string, filePath string,
+	lookupEnv func(string) (string, bool),
+) (map[string]configSource, error) {
+	sources := make(map[string]configSource, len(settings))
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = configSource{kind: sourceFlag}
+	})
+
+	known := make(map[string]bool, len(settings))
+	var errs []error
+	for _, s := range settings {
+		known[s.flag] = true
+		if _, ok := sources[s.flag]; ok {
+			continue
+		}
+		source := configSource{kind: sourceDefault}
+		var value string
+		var ok bool
+		if s.env != "" {
+			value, ok = lookupEnv(s.env)
+		}
+		if ok && value != "" {
+			source = configSource{kind: sourceEnv, detail: s.env}
+		} else if value, ok = file[s.flag]; ok {
+			source = configSource{kind: sourceFile, detail: filePath}
+		}
+		if source.kind != sourceDefault {
+			if err := fs.Set(s.flag, value); err != nil {
+				shown := value
+				if s.secret {
+					shown = redact(value)
+				}
+				errs = append(errs, fmt.Errorf("%s from %s: invalid value %q: %w", s.flag, source, shown, err))
+			}
+		}
+		sources[s.flag] = source
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(file)) {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q; valid settings are %s",
+				filePath, fileKey(name), strings.Join(fileKeys(settings), ", ")))
+		}
+	}
+	return sources, errors.Join(errs...)
+}
+
+func fileKeys(settings []setting) []string {
+	keys := make([]string, 0, len(settings))
+	for _, s := range settings {
+		keys = append(keys, fileKey(s.flag))
+	}
+	return keys
+}
+
+// loadConfig applies the environment and the config file (from --config or
+// $CONFIG_FILE) to the command line flags.
+func loadConfig() (map[string]configSource, error) {
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	var file map[string]string
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, fmt.Errorf("config file: %w", err)
+		}
+	}
+	return applyConfig(flag.CommandLine, settings, file, path, os.LookupEnv)
+}
+
+// validateConfig checks the effective configuration, reporting every problem
+// with the setting's source and how to fix it.
+func validateConfig(sources map[string]configSource) error {
+	var errs []error
+	invalid := func(name, format string, args ...any) {
+		hint := "--" + name
+		for _, s := range settings {
+			switch {
+			case s.flag != name:
+			case s.env == "":
+				hint += " or " + fileKey(name) + " in the config file"
+			default:
+				hint += ", $" + s.env + " or " + fileKey(name) + " in the config file"
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s (from %s): %s; set it with %s", name, sources[name], fmt.Sprintf(format, args...), hint))
+	}
+
+	if n, err := strconv.Atoi(*port); err != nil || n < 1 || n > 65535 {
+		invalid("port", "%q is not a TCP port between 1 and 65535", *port)
+	}
+	if *appID <= 0 {
+		invalid("app-id", "%d is not a GitHub App ID", *appID)
+	}
+	if *clientID == "" {
+		invalid("client-id", "must not be empty")
+	}
+	if u, err := url.Parse(*redirectURI); err != nil || u.Host == "" ||
+		(u.Scheme != "https" && (u.Scheme != "http" || !isLocalhost(u.Host))) {
+		invalid("redirect-uri", "%q must be an absolute https URL (http is only allowed for localhost)", *redirectURI)
+	}
+	if _, err := parseAllowedOrigins(*allowedOrigins); err != nil {
+		invalid("allowed-origins", "%v", err)
+	}
+	if err := validateBaseDomain(*baseDomain); err != nil {
+		invalid("base-domain", "%v", err)
+	}
+	if err := validateWorkspaceMode(*workspaceMode); err != nil {
+		invalid("workspace-mode", "%v", err)
+	}
+	if _, err := parseHostList(*allowedHosts); err != nil {
+		invalid("allowed-hosts", "%v", err)
+	}
+	if *originalHostSecret != "" && len(*originalHostSecret) < 32 {
+		invalid("original-host-secret", "must be at least 32 characters, got %d (generate one with: openssl rand -hex 32)", len(*originalHostSecret))
+	}
+	if *assetsOverride != "" {
+		if info, err := os.Stat(*assetsOverride); err != nil || !info.IsDir() {
+			invalid("assets-override", "%q is not a readable directory", *assetsOverride)
+		}
+	}
+	if *adminToken != "" && len(*adminToken) < 32 {
+		invalid("admin-token", "must be at least 32 characters, got %d (generate one with: openssl rand -hex 32)", len(*adminToken))
+	}
+	if _, err := parseIPAllowlist(*adminAllowedIPs); err != nil {
+		invalid("admin-allowed-ips", "%v", err)
+	}
+	if err := validateTLSMode(*tlsMode); err != nil {
+		invalid("tls", "%v", err)
+	}
+	if *tlsMode == tlsModeFiles {
+		for name, path := range map[string]string{"tls-cert": *tlsCertFile, "tls-key": *tlsKeyFile} {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				invalid(name, "%q is not a readable file (required by --tls=files)", path)
+			}
+		}
+	}
+	if *tlsMode != tlsModeOff && *httpPort != "" {
+		if n, err := strconv.Atoi(*httpPort); err != nil || n < 1 || n > 65535 || *httpPort == *port {
+			invalid("http-port", "%q must be a TCP port other than --port", *httpPort)
+		}
+	}
+	if *tlsMode == tlsModeACME {
+		if u, err := url.Parse(*acmeDirectory); err != nil || u.Scheme != "https" || u.Host == "" {
+			invalid("acme-directory", "%q is not an https URL", *acmeDirectory)
+		}
+		if *acmeDNSHook != "" {
+			if info, err := os.Stat(*acmeDNSHook); err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+				invalid("acme-dns-hook", "%q is not an executable file", *acmeDNSHook)
+			}
+		} else if !usePathWorkspaces() {
+			invalid("acme-dns-hook", "must be set with --tls=acme: subdomain workspaces need a wildcard certificate (or use --workspace-mode=path)")
+		}
+	}
+	if _, err := parseEgressProxy(*egressProxyURL, *egressProxyUser, *egressProxyPassword); err != nil {
+		invalid("egress-proxy", "%v", err)
+	}
+	if *egressCAFile != "" {
+		if _, err := loadCABundle(*egressCAFile); err != nil {
+			invalid("egress-ca-file", "%v", err)
+		}
+	}
+	if _, err := parseHostList(*egressAllowedHosts); err != nil {
+		invalid("egress-allowed-hosts", "%v", err)
+	}
+	if *stateSnapshotPath != "" {
+		if key, err := loadSnapshotKey(*stateSnapshotKey); err != nil {
+			invalid("state-snapshot-key", "%v", err)
+		} else {
+			wipe(key)
+		}
+		if info, err := os.Stat(filepath.Dir(*stateSnapshotPath)); err != nil || !info.IsDir() {
+			invalid("state-snapshot", "the directory of %q does not exist", *stateSnapshotPath)
+		}
+	}
+	maintenanceTimes := map[string]time.Time{}
+	for name, value := range map[string]string{"maintenance-start": *maintenanceStart, "maintenance-end": *maintenanceEnd} {
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			invalid(name, "%q is not an RFC 3339 time such as 2026-01-02T15:04:05Z", value)
+			continue
+		}
+		maintenanceTimes[name] = t
+	}
+	if start, ok := maintenanceTimes["maintenance-start"]; ok {
+		if end, ok := maintenanceTimes["maintenance-end"]; ok && !end.After(start) {
+			invalid("maintenance-end", "%s must be after --maintenance-start %s", *maintenanceEnd, *maintenanceStart)
+		}
+	}
+	if *metricsAddr != "" {
+		if _, p, err := net.SplitHostPort(*metricsAddr); err != nil || p == "" || p == *port {
+			invalid("metrics-addr", "%q must be a host:port other than the public port, such as 127.0.0.1:9090", *metricsAddr)
+		}
+	}
+	for name, n := range map[string]int{
+		"rate-limit-requests": *rateLimitRequests,
+		"max-failed-logins":   *maxFailedLogins,
+		"max-auth-requests":   *maxAuthRequests,
+		"max-static-requests": *maxStaticRequests,
+	} {
+		if n < 1 {
+			invalid(name, "%d must be at least 1", n)
+		}
+	}
+	for name, d := range map[string]time.Duration{
+		"rate-limit-window":   *rateLimitWindow,
+		"failed-login-window": *failedLoginWindow,
+		"http-timeout":        *httpTimeout,
+		"shutdown-timeout":    *shutdownTimeout,
+		"state-expiry":        *stateExpiry,
+	} {
+		if d < time.Second {
+			invalid(name, "%v must be at least 1s", d)
+		}
+	}
+
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// writeConfig prints the effective value and source of every setting, with
+// secrets redacted.
+func writeConfig(w io.Writer, fs *flag.FlagSet, settings []setting, sources map[string]configSource) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	for _, s := range settings {
+		f := fs.Lookup(s.flag)
+		if f == nil {
+			continue
+		}
+		value := f.Value.String()
+		if s.secret {
+			value = redact(value)
+		}
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.flag, value, sources[s.flag])
+	}
+	return tw.Flush()
+}
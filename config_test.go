@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfigSettingsExist verifies every configurable setting is a registered flag.
+func TestConfigSettingsExist(t *testing.T) {
+	for _, s := range settings {
+		if flag.Lookup(s.flag) == nil {
+			t.Errorf("setting %q has no flag", s.flag)
+		}
+	}
+}
+
+// TestConfigPrecedence verifies flag > env > file > default.
+func TestConfigPrecedence(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fromFlag := fs.String("from-flag", "default", "")
+	fromEnv := fs.String("from-env", "default", "")
+	fromFile := fs.Duration("from-file", time.Second, "")
+	fromDefault := fs.Int("from-default", 7, "")
+	layered := []setting{
+		{flag: "from-flag", env: "FROM_FLAG"},
+		{flag: "from-env", env: "FROM_ENV"},
+		{flag: "from-file", env: "FROM_FILE"},
+		{flag: "from-default", env: "FROM_DEFAULT"},
+	}
+	if err := fs.Parse([]string{"--from-flag=flag"}); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"FROM_FLAG": "env", "FROM_ENV": "env", "FROM_FILE": ""}
+	file := map[string]string{"from-flag": "file", "from-env": "file", "from-file": "2m"}
+
+	sources, err := applyConfig(fs, layered, file, "app.yaml", func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if *fromFlag != "flag" || *fromEnv != "env" || *fromFile != 2*time.Minute || *fromDefault != 7 {
+		t.Errorf("values = %q %q %v %d, want flag env 2m0s 7", *fromFlag, *fromEnv, *fromFile, *fromDefault)
+	}
+	for name, want := range map[string]string{
+		"from-flag":    "flag",
+		"from-env":     "env FROM_ENV",
+		"from-file":    "file app.yaml",
+		"from-default": "default",
+	} {
+		if got := sources[name].String(); got != want {
+			t.Errorf("source of %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestConfigWithoutEnv verifies settings without an environment variable
+// ignore the environment.
+func TestConfigWithoutEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	dev := fs.Bool("dev", false, "")
+	sources, err := applyConfig(fs, []setting{{flag: "dev"}}, map[string]string{}, "", func(string) (string, bool) {
+		return "true", true
+	})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if *dev || sources["dev"].kind != sourceDefault {
+		t.Errorf("dev = %v from %s, want the default", *dev, sources["dev"])
+	}
+
+	sources, err = applyConfig(fs, []setting{{flag: "dev"}}, map[string]string{"dev": "true"}, "app.yaml", func(string) (string, bool) {
+		return "", false
+	})
+	if err != nil {
+		t.Fatalf("applyConfig() error = %v", err)
+	}
+	if !*dev || sources["dev"].kind != sourceFile {
+		t.Errorf("dev = %v from %s, want true from the file", *dev, sources["dev"])
+	}
+}
+
+// TestConfigErrors verifies bad values and unknown keys are reported together with their source.
+func TestConfigErrors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("limit", 1, "")
+	fs.String("token", "", "")
+	layered := []setting{{flag: "limit", env: "LIMIT"}, {flag: "token", env: "TOKEN", secret: true}}
+	file := map[string]string{"limit": "lots", "rate-limt": "5"}
+
+	_, err := applyConfig(fs, layered, file, "app.toml", func(string) (string, bool) { return "", false })
+	if err == nil {
+		t.Fatal("applyConfig() succeeded, want errors")
+	}
+	for _, want := range []string{`limit from file app.toml: invalid value "lots"`, `unknown setting "rate_limt"`, "valid settings are limit, token"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+// TestReadConfigFile verifies YAML and TOML files load the same settings.
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.yaml": "port: 9090\ndev: true\nrate_limit_window: 2m\nallowed_origins:\n  - https://a.example\n  - https://b.example\n",
+		"config.toml": "port = 9090\ndev = true\nrate_limit_window = \"2m\"\nallowed_origins = [\"https://a.example\", \"https://b.example\"]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		values, err := readConfigFile(path)
+		if err != nil {
+			t.Fatalf("readConfigFile(%s) error = %v", name, err)
+		}
+		for key, want := range map[string]string{
+			"port":              "9090",
+			"dev":               "true",
+			"rate-limit-window": "2m",
+			"allowed-origins":   "https://a.example,https://b.example",
+		} {
+			if values[key] != want {
+				t.Errorf("%s: %s = %q, want %q", name, key, values[key], want)
+			}
+		}
+	}
+
+	nested := filepath.Join(dir, "nested.yaml")
+	if err := os.WriteFile(nested, []byte("admin:\n  token: x\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfigFile(nested); err == nil || !strings.Contains(err.Error(), "admin") {
+		t.Errorf("nested settings error = %v, want one naming the key", err)
+	}
+	if _, err := readConfigFile(filepath.Join(dir, "config.json")); err == nil {
+		t.Error("reading an unsupported file type succeeded")
+	}
+}
+
+// TestValidateConfig verifies startup validation explains how to fix each problem.
+func TestValidateConfig(t *testing.T) {
+	prevPort, prevRedirect, prevToken, prevWindow := *port, *redirectURI, *adminToken, *rateLimitWindow
+	t.Cleanup(func() {
+		*port, *redirectURI, *adminToken, *rateLimitWindow = prevPort, prevRedirect, prevToken, prevWindow
+	})
+
+	*redirectURI = "https://auth." + *baseDomain + "/oauth/callback"
+	if err := validateConfig(map[string]configSource{}); err != nil {
+		t.Fatalf("validateConfig() error = %v for the defaults", err)
+	}
+
+	*port = "80a"
+	*redirectURI = "http://auth.example.com/oauth/callback"
+	*adminToken = "short"
+	*rateLimitWindow = 0
+	err := validateConfig(map[string]configSource{"port": {kind: sourceEnv, detail: "PORT"}})
+	if err == nil {
+		t.Fatal("validateConfig() succeeded, want errors")
+	}
+	for _, want := range []string{
+		`port (from env PORT): "80a" is not a TCP port`,
+		"set it with --port, $PORT or port in the config file",
+		"redirect-uri (from ",
+		"admin-token (from ",
+		"rate-limit-window (from ",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "short") {
+		t.Error("error leaks the admin token")
+	}
+}
+
+// TestWriteConfigRedactsSecrets verifies --print-config never prints secrets.
+func TestWriteConfigRedactsSecrets(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("client-secret", "super-secret-value", "")
+	fs.String("port", "8080", "")
+	layered := []setting{{flag: "port", env: "PORT"}, {flag: "client-secret", env: "GITHUB_CLIENT_SECRET", secret: true}}
+
+	var out strings.Builder
+	sources := map[string]configSource{"port": {kind: sourceDefault}, "client-secret": {kind: sourceEnv, detail: "GITHUB_CLIENT_SECRET"}}
+	if err := writeConfig(&out, fs, layered, sources); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "super-secret-value") {
+		t.Fatalf("config output leaks a secret:\n%s", out.String())
+	}
+	for _, want := range []string{"port           8080", redactedValue + "  env GITHUB_CLIENT_SECRET"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("config output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS settings for API routes.
+const (
+	// corsMaxAge is how long browsers may cache a preflight result.
+	corsMaxAge = 10 * time.Minute
+
+	corsExposedHeaders = "Retry-After, X-Request-ID"
+)
+
+var (
+	// corsAllowedMethods are the methods API routes accept cross-origin.
+	corsAllowedMethods = []string{http.MethodGet, http.MethodPost}
+	// corsAnyOriginMethods are the methods offered to origins only "*" admits;
+	// CSRF protection refuses their POSTs.
+	corsAnyOriginMethods = []string{http.MethodGet}
+	// corsAllowedHeaders are the request headers API callers may send, lower case.
+	corsAllowedHeaders = []string{"authorization", "content-type", "x-request-id"}
+)
+
+// originPattern is one --allowed-origins entry. With subdomains set it matches
+// any subdomain of host, but not host itself.
+type originPattern struct {
+	scheme     string
+	host       string
+	subdomains bool
+}
+
+// corsPolicy decides which cross-origin callers may use the API. The base
+// domain and its https subdomains are always allowed; "*" allows any origin
+// but never with credentials.
+type corsPolicy struct {
+	anyOrigin bool
+	origins   []originPattern
+}
+
+// parseAllowedOrigins parses --allowed-origins: origins such as
+// https://example.com, https://*.example.com for its subdomains, or *.
+func parseAllowedOrigins(list string) (*corsPolicy, error) {
+	policy := &corsPolicy{}
+	for entry := range strings.SplitSeq(list, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			policy.anyOrigin = true
+			continue
+		default:
+		}
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.Path != "" || u.User != nil || u.RawQuery != "" {
+			return nil, fmt.Errorf("%q is not an origin such as https://example.com or https://*.example.com", entry)
+		}
+		host, subdomains := strings.CutPrefix(strings.ToLower(u.Host), "*.")
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("%q may only use * as its first label, as in https://*.example.com", entry)
+		}
+		policy.origins = append(policy.origins, originPattern{scheme: u.Scheme, host: host, subdomains: subdomains})
+	}
+	return policy, nil
+}
+
+// allows reports whether origin may call the API with credentials.
+func (p *corsPolicy) allows(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if u.Scheme == "https" && isOurHost(host) {
+		return true
+	}
+	return slices.ContainsFunc(p.origins, func(o originPattern) bool {
+		if o.scheme != u.Scheme {
+			return false
+		}
+		if o.subdomains {
+			return strings.HasSuffix(host, "."+o.host)
+		}
+		return host == o.host
+	})
+}
+
+// sameOrigin reports whether origin is the host the request was made to, which
+// needs no CORS headers.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := r.Header.Get(originalHostHeader)
+	if host == "" {
+		host = r.Host
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+// handler applies the policy to an API route. Allowed origins get their own
+// origin echoed with credentials; "*" gets a wildcard without them. Other
+// cross-origin requests are refused, and preflights are answered here.
+func (p *corsPolicy) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		// Responses differ by Origin even when it is refused, so caches must key on it
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods := corsAllowedMethods
+		switch {
+		case p.allows(origin):
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Set("Access-Control-Allow-Credentials", "true")
+		case p.anyOrigin:
+			h.Set("Access-Control-Allow-Origin", "*")
+			methods = corsAnyOriginMethods
+		default:
+			logFrom(r.Context()).Warn("Rejected cross-origin API request", securityEvent, "origin", origin)
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !slices.Contains(methods, method) || !corsHeadersAllowed(r.Header.Get("Access-Control-Request-Headers")) {
+			logFrom(r.Context()).Info("Rejected CORS preflight", "origin", origin, "method", method,
+				"headers", r.Header.Get("Access-Control-Request-Headers"))
+			http.Error(w, "Method or headers not allowed", http.StatusForbidden)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		h.Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge/time.Second)))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// protect applies CSRF protection to an API route, except to origins the
+// policy allows with credentials: a POST that passed their preflight must not
+// then be refused as cross-site.
+func (p *corsPolicy) protect(csrf *http.CrossOriginProtection, next http.Handler) http.Handler {
+	protected := csrf.Handler(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && p.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// corsHeadersAllowed reports whether every header in a preflight's
+// Access-Control-Request-Headers list may be sent.
+func corsHeadersAllowed(list string) bool {
+	for name := range strings.SplitSeq(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !slices.Contains(corsAllowedHeaders, name) {
+			return false
+		}
+	}
+	return true
+}
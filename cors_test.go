@@ -0,0 +1,322 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAllowedOrigins sets --allowed-origins for the test and returns its policy.
+func useAllowedOrigins(t *testing.T, origins string) *corsPolicy {
+	t.Helper()
+	prev := *allowedOrigins
+	t.Cleanup(func() { *allowedOrigins = prev })
+	*allowedOrigins = origins
+	policy, err := parseAllowedOrigins(origins)
+	if err != nil {
+		t.Fatalf("parseAllowedOrigins(%q) error = %v", origins, err)
+	}
+	return policy
+}
+
+// corsRequest returns a request to the API on example.test from origin.
+func corsRequest(method, origin string) *http.Request {
+	req := httptest.NewRequest(method, "/oauth/user", http.NoBody)
+	req.Host = "example.test"
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	return req
+}
+
+func TestParseAllowedOrigins(t *testing.T) {
+	for _, list := range []string{"", "*", "https://app.test", "https://*.app.test, http://localhost:5173"} {
+		if _, err := parseAllowedOrigins(list); err != nil {
+			t.Errorf("parseAllowedOrigins(%q) error = %v", list, err)
+		}
+	}
+	for _, list := range []string{"app.test", "ftp://app.test", "https://app.test/path", "https://a.*.test", "https://user@app.test"} {
+		if _, err := parseAllowedOrigins(list); err == nil {
+			t.Errorf("parseAllowedOrigins(%q) accepted an invalid origin", list)
+		}
+	}
+}
+
+// TestCORSAllowedOrigins verifies allowed origins are echoed with credentials.
+func TestCORSAllowedOrigins(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	policy := useAllowedOrigins(t, "https://app.partner.test, https://*.preview.test")
+	handler := policy.handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, origin := range []string{"https://app.partner.test", "https://pr-42.preview.test", "https://acme.example.test"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, corsRequest(http.MethodGet, origin))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q", origin, got)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %q, want true", origin, got)
+		}
+		if got := rec.Header().Get("Access-Control-Expose-Headers"); got != corsExposedHeaders {
+			t.Errorf("%s: Access-Control-Expose-Headers = %q", origin, got)
+		}
+		if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+			t.Errorf("%s: Vary = %q, want Origin", origin, rec.Header().Values("Vary"))
+		}
+	}
+}
+
+// TestCORSDeniedOrigins verifies other origins are refused without CORS headers.
+func TestCORSDeniedOrigins(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	policy := useAllowedOrigins(t, "https://*.preview.test")
+	buf := useTestLogger(t)
+	called := false
+	handler := policy.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+	for _, origin := range []string{
+		"https://evil.test",
+		"https://preview.test",          // the wildcard covers subdomains only
+		"http://pr-42.preview.test",     // scheme must match
+		"http://acme.example.test",      // the base domain is https only
+		"https://example.test.evil.com", // suffix tricks
+		"null",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, corsRequest(http.MethodGet, origin))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want none", origin, got)
+		}
+		if !slices.Contains(rec.Header().Values("Vary"), "Origin") {
+			t.Errorf("%s: Vary = %q, want Origin", origin, rec.Header().Values("Vary"))
+		}
+	}
+	if called {
+		t.Error("handler ran for a denied origin")
+	}
+	if len(logLines(t, buf)) == 0 {
+		t.Error("denied origins were not logged")
+	}
+}
+
+// TestCORSSameOrigin verifies same-origin and non-browser requests pass through untouched.
+func TestCORSSameOrigin(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	policy := useAllowedOrigins(t, "")
+	handler := policy.handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for _, origin := range []string{"", "https://example.test"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, corsRequest(http.MethodGet, origin))
+		if rec.Code != http.StatusOK {
+			t.Errorf("origin %q: status = %d, want 200", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want none", origin, got)
+		}
+	}
+}
+
+// TestCORSPreflight verifies preflights are answered and cached, and refused
+// for methods or headers the API does not accept.
+func TestCORSPreflight(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	policy := useAllowedOrigins(t, "https://app.partner.test")
+	handler := policy.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("preflight reached the handler")
+	}))
+
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := corsRequest(http.MethodOptions, origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://app.partner.test", http.MethodPost, "Content-Type, Authorization")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.partner.test",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "authorization, content-type, x-request-id",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	vary := rec.Header().Values("Vary")
+	for _, want := range []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"} {
+		if !slices.Contains(vary, want) {
+			t.Errorf("Vary = %q, missing %s", vary, want)
+		}
+	}
+
+	for name, rec := range map[string]*httptest.ResponseRecorder{
+		"method": preflight("https://app.partner.test", http.MethodDelete, ""),
+		"header": preflight("https://app.partner.test", http.MethodGet, "X-Custom"),
+		"origin": preflight("https://evil.test", http.MethodGet, ""),
+	} {
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("disallowed %s: status = %d, want 403", name, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "" {
+			t.Errorf("disallowed %s: Access-Control-Allow-Methods = %q, want none", name, got)
+		}
+	}
+}
+
+// TestCORSAnyOrigin verifies "*" opens the API without credentials, while
+// listed origins keep them.
+func TestCORSAnyOrigin(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	policy := useAllowedOrigins(t, "*, https://app.partner.test")
+	handler := policy.handler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, corsRequest(http.MethodGet, "https://anyone.test"))
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("any origin: status = %d, Access-Control-Allow-Origin = %q, want 200 and *",
+			rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("any origin: Access-Control-Allow-Credentials = %q, want none", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, corsRequest(http.MethodGet, "https://app.partner.test"))
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("listed origin: Access-Control-Allow-Credentials = %q, want true", got)
+	}
+}
+
+// TestCORSOnAPIRoutes verifies the mux applies the policy to the API routes.
+func TestCORSOnAPIRoutes(t *testing.T) {
+	// Set before useBaseDomain so CSRF protection trusts the origin too
+	useAllowedOrigins(t, "https://app.partner.test")
+	useBaseDomain(t, "example.test")
+	useFakeGitHub(t, "alice")
+	setupAuthCodeStore(t)
+	handler := newMux(nil)
+
+	for _, path := range []string{"/oauth/user", "/oauth/exchange"} {
+		req := httptest.NewRequest(http.MethodOptions, path, http.NoBody)
+		req.Host = "example.test"
+		req.Header.Set("Origin", "https://app.partner.test")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.partner.test" {
+			t.Errorf("%s preflight: status = %d, Access-Control-Allow-Origin = %q",
+				path, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+
+		req = httptest.NewRequest(http.MethodGet, path, http.NoBody)
+		req.Host = "example.test"
+		req.Header.Set("Origin", "https://evil.test")
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s from a denied origin: status = %d, want 403", path, rec.Code)
+		}
+	}
+}
+
+// useExchangeMux returns the mux with /oauth/exchange ready to be called.
+func useExchangeMux(t *testing.T) http.Handler {
+	t.Helper()
+	useBaseDomain(t, "example.test")
+	setupAuthCodeStore(t)
+	exchangeRateLimiter = &rateLimiter{requests: make(map[string][]time.Time), limit: *rateLimitRequests, window: *rateLimitWindow}
+	return newMux(nil)
+}
+
+// exchangeRequest returns a cross-site request to /oauth/exchange from origin.
+func exchangeRequest(method, origin string) *http.Request {
+	req := httptest.NewRequest(method, "/oauth/exchange", strings.NewReader("code=unknown"))
+	req.Host = "example.test"
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	return req
+}
+
+// TestCORSExchangePassesCSRF verifies origins allowed with credentials may
+// POST to /oauth/exchange cross-site, which CSRF protection would otherwise
+// refuse, while origins only "*" admits may not.
+func TestCORSExchangePassesCSRF(t *testing.T) {
+	useAllowedOrigins(t, "*, https://app.partner.test, https://*.preview.test")
+	handler := useExchangeMux(t)
+
+	for origin, wantCSRF := range map[string]bool{
+		"https://app.partner.test":  false,
+		"https://pr-1.preview.test": false,
+		"https://acme.example.test": false,
+		"https://anyone.test":       true,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, exchangeRequest(http.MethodPost, origin))
+		if refused := rec.Code == http.StatusForbidden; refused != wantCSRF {
+			t.Errorf("%s: status = %d, want CSRF refusal %v", origin, rec.Code, wantCSRF)
+		}
+	}
+}
+
+// TestCORSExchangePreflight verifies a POST to /oauth/exchange is accepted
+// whenever its preflight was, and that "*" does not advertise POST.
+func TestCORSExchangePreflight(t *testing.T) {
+	useAllowedOrigins(t, "*, https://*.preview.test")
+	handler := useExchangeMux(t)
+
+	for origin, wantPOST := range map[string]bool{"https://pr-1.preview.test": true, "https://anyone.test": false} {
+		req := exchangeRequest(http.MethodOptions, origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if allowed := rec.Code == http.StatusNoContent; allowed != wantPOST {
+			t.Errorf("%s: POST preflight status = %d, want allowed %v", origin, rec.Code, wantPOST)
+		}
+		if !wantPOST {
+			continue
+		}
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, exchangeRequest(http.MethodPost, origin))
+		if rec.Code == http.StatusForbidden {
+			t.Errorf("%s: POST after its preflight status = 403", origin)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q", origin, got)
+		}
+	}
+
+	req := exchangeRequest(http.MethodOptions, "https://anyone.test")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Methods") != "GET" {
+		t.Errorf("any origin GET preflight: status = %d, Access-Control-Allow-Methods = %q, want 204 and GET",
+			rec.Code, rec.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
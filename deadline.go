@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codeGROOVE-dev/retry"
+)
+
+const (
+	// responseMargin is the part of the server's write timeout kept back from
+	// a route's deadline so there is still time to send an error page.
+	responseMargin = 500 * time.Millisecond
+	// minAttemptTime is the least time worth giving a GitHub attempt; a retry
+	// is skipped when the deadline cannot fit its backoff plus this much.
+	minAttemptTime = 250 * time.Millisecond
+
+	// GitHub retry policy: exponential backoff from retryDelay up to
+	// retryMaxDelay plus up to retryMaxJitter, for at most retryAttempts
+	// attempts.
+	retryAttempts = 10
+	retryDelay    = 100 * time.Millisecond
+	retryMaxDelay = 30 * time.Second
+
+	// Retry-After hints for pages shown when GitHub fails us.
+	unavailableRetryAfter    = 30 * time.Second
+	gatewayTimeoutRetryAfter = 5 * time.Second
+)
+
+// retryMaxJitter spreads out retries so clients that failed together do not
+// hit GitHub again in lockstep.
+var retryMaxJitter = time.Second
+
+var (
+	// errGitHubUnavailable marks GitHub failures worth retrying: network
+	// errors and 5xx responses.
+	errGitHubUnavailable = errors.New("GitHub unavailable")
+	// errDeadlineBudget is returned when retries stop early because the
+	// request's deadline cannot fit another attempt.
+	errDeadlineBudget = errors.New("deadline leaves no time for another attempt")
+)
+
+// routeDeadline is how long a GitHub-backed route may work before it must
+// answer, leaving responseMargin of the write timeout for the response.
+func routeDeadline() time.Duration {
+	return max(*httpTimeout-responseMargin, *httpTimeout/2)
+}
+
+// withDeadline runs next with a context that expires after d. Everything the
+// handler calls, including GitHub retries, shares that one budget.
+func withDeadline(d time.Duration, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		next(w, r.WithContext(ctx))
+	})
+}
+
+// retryBudget decides whether a failed GitHub attempt is retried. It computes
+// each backoff, jitter included, itself so it can refuse a retry the deadline
+// cannot fit.
+type retryBudget struct {
+	ctx       context.Context //nolint:containedctx // deadline source for a single retry.Do
+	failures  uint
+	next      time.Duration
+	exhausted bool
+}
+
+func (b *retryBudget) retryIf(err error) bool {
+	if !retry.IsRecoverable(err) {
+		return false
+	}
+	b.failures++
+	b.next = retryDelay << min(b.failures-1, 16)
+	if retryMaxJitter > 0 {
+		b.next += rand.N(retryMaxJitter)
+	}
+	b.next = min(b.next, retryMaxDelay)
+	if deadline, ok := b.ctx.Deadline(); ok && time.Until(deadline) < b.next+minAttemptTime {
+		b.exhausted = true
+		return false
+	}
+	return true
+}
+
+func (b *retryBudget) delay(uint, error, *retry.Config) time.Duration {
+	return b.next
+}
+
+// wrap marks err when retries were cut short by the deadline.
+func (b *retryBudget) wrap(err error) error {
+	if err != nil && b.exhausted {
+		return fmt.Errorf("%w: %w", errDeadlineBudget, err)
+	}
+	return err
+}
+
+// githubRetryOptions is the retry policy shared by GitHub calls. Retries stop
+// at retryAttempts, at an unrecoverable error, or once ctx's deadline cannot
+// fit another attempt.
+func githubRetryOptions(ctx context.Context, call string, budget *retryBudget) []retry.Option {
+	return []retry.Option{
+		retry.Context(ctx),
+		retry.Attempts(retryAttempts),
+		retry.MaxDelay(retryMaxDelay),
+		retry.DelayType(budget.delay),
+		retry.RetryIf(budget.retryIf),
+		retry.OnRetry(func(n uint, err error) {
+			logFrom(ctx).Info("Retrying GitHub call", "call", call, "attempt", n+1, "delay", budget.next, "error", err)
+			githubRetries.WithLabelValues(call).Inc()
+		}),
+	}
+}
+
+// githubFailureStatus maps a failed GitHub call to the status the user sees:
+// 504 when an attempt ran into the deadline, 503 when GitHub kept failing,
+// including when the deadline cut the retries short. Other failures are not
+// ours to explain and return 0.
+func githubFailureStatus(err error) (code int, retryAfter time.Duration) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, gatewayTimeoutRetryAfter
+	case errors.Is(err, errGitHubUnavailable):
+		return http.StatusServiceUnavailable, unavailableRetryAfter
+	default:
+		return 0, 0
+	}
+}
+
+// githubFailurePage is shown to browsers when GitHub is down or too slow.
+var githubFailurePage = template.Must(template.New("github-failure").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>{{.Title}}</title>
+</head>
+<body>
+    <h1>{{.Title}}</h1>
+    <p>{{.Message}}</p>
+    <p>Please try again in {{.RetryAfter}} seconds.</p>
+</body>
+</html>
+`))
+
+// writeGitHubFailure answers with a 503 or 504 and Retry-After if err is a
+// GitHub outage or timeout, as an HTML page or plain text. It reports false,
+// writing nothing, for other errors.
+func writeGitHubFailure(w http.ResponseWriter, r *http.Request, err error, asHTML bool) bool {
+	code, retryAfter := githubFailureStatus(err)
+	if code == 0 {
+		return false
+	}
+	seconds := int(retryAfter / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Cache-Control", "no-store")
+
+	message := "GitHub is not responding right now."
+	if code == http.StatusGatewayTimeout {
+		message = "GitHub took too long to respond."
+	}
+	if !asHTML {
+		http.Error(w, message+" Please try again.", code)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if err := githubFailurePage.Execute(w, struct {
+		Title      string
+		Message    string
+		RetryAfter int
+	}{Title: http.StatusText(code), Message: message, RetryAfter: seconds}); err != nil {
+		logFrom(r.Context()).Error("Failed to write GitHub failure page", "error", err)
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useFlakyGitHub points GitHub calls at a server that answers every request
+// with handler, counting the requests.
+func useFlakyGitHub(t *testing.T, handler http.HandlerFunc) *atomic.Int32 {
+	t.Helper()
+	resetBreakers(t)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	prevURL, prevAPI, prevID, prevSecret := githubURL, githubAPIURL, *clientID, *clientSecret
+	t.Cleanup(func() {
+		githubURL, githubAPIURL, *clientID, *clientSecret = prevURL, prevAPI, prevID, prevSecret
+	})
+	githubURL, githubAPIURL = srv.URL, srv.URL
+	*clientID, *clientSecret = "test_client_id", "test_secret"
+	return &hits
+}
+
+// TestRetryBudget verifies retries stop once the deadline cannot fit another
+// attempt, instead of sleeping into it.
+func TestRetryBudget(t *testing.T) {
+	hits := useFlakyGitHub(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	prevJitter := retryMaxJitter
+	t.Cleanup(func() { retryMaxJitter = prevJitter })
+	retryMaxJitter = 0
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := userInfo(ctx, testToken)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, errDeadlineBudget) || !errors.Is(err, errGitHubUnavailable) {
+		t.Fatalf("userInfo() error = %v, want deadline budget and GitHub unavailable", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("userInfo() returned after the deadline (%v)", elapsed)
+	}
+	// Backoff of 100, 200 and 400ms fits a second; the next 800ms does not.
+	if got := hits.Load(); got != 4 {
+		t.Errorf("GitHub called %d times, want 4", got)
+	}
+	if code, retryAfter := githubFailureStatus(err); code != http.StatusServiceUnavailable || retryAfter != unavailableRetryAfter {
+		t.Errorf("githubFailureStatus() = %d, %v; want 503 with Retry-After", code, retryAfter)
+	}
+}
+
+// TestRetryJitter verifies backoffs are jittered and the budget counts the
+// jitter when deciding whether a retry fits.
+func TestRetryJitter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	budget := &retryBudget{ctx: ctx}
+	deadline, _ := ctx.Deadline()
+
+	seen := make(map[time.Duration]bool)
+	for budget.retryIf(errGitHubUnavailable) {
+		base := retryDelay << (budget.failures - 1)
+		if budget.next < base || budget.next >= base+retryMaxJitter {
+			t.Errorf("retry %d delay = %v, want within [%v, %v)", budget.failures, budget.next, base, base+retryMaxJitter)
+		}
+		if left := time.Until(deadline); left < budget.next+minAttemptTime {
+			t.Errorf("retry %d allowed with %v left for a %v delay", budget.failures, left, budget.next)
+		}
+		seen[budget.next-base] = true
+	}
+	if !budget.exhausted {
+		t.Error("retries stopped without exhausting the budget")
+	}
+	if budget.failures > 1 && len(seen) == 1 {
+		t.Error("every retry got the same jitter")
+	}
+}
+
+// TestRouteDeadline verifies a hanging GitHub gives /oauth/user a 504 with
+// Retry-After before the server's write timeout.
+func TestRouteDeadline(t *testing.T) {
+	useFlakyGitHub(t, func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	prevTimeout := *httpTimeout
+	t.Cleanup(func() { *httpTimeout = prevTimeout })
+	*httpTimeout = time.Second
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/user", http.NoBody)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	newMux(nil).ServeHTTP(rec, req)
+
+	if elapsed := time.Since(start); elapsed >= *httpTimeout {
+		t.Errorf("answered after %v, want within the %v write timeout", elapsed, *httpTimeout)
+	}
+	if rec.Code != http.StatusGatewayTimeout || rec.Header().Get("Retry-After") != "5" {
+		t.Errorf("response = %d Retry-After %q, want 504 with Retry-After 5", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+// TestCallbackUnavailablePage verifies a GitHub outage during the callback
+// shows a 503 page with Retry-After rather than a bare 500.
+func TestCallbackUnavailablePage(t *testing.T) {
+	useFlakyGitHub(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	prevTimeout, prevRedirect := *httpTimeout, *redirectURI
+	t.Cleanup(func() { *httpTimeout, *redirectURI = prevTimeout, prevRedirect })
+	*httpTimeout, *redirectURI = time.Second, "https://auth.example.test/oauth/callback"
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/callback?state=s1&code=c1", http.NoBody)
+	req.RemoteAddr = "198.51.100.43:1234"
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "s1"})
+	rec := httptest.NewRecorder()
+	newMux(nil).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("response = %d Retry-After %q, want 503 with Retry-After 30", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") || !strings.Contains(rec.Body.String(), "try again in 30 seconds") {
+		t.Errorf("page = %q %s, want an HTML page with the retry hint", rec.Header().Get("Content-Type"), rec.Body)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Developer mode settings.
+const (
+	devPollInterval = 500 * time.Millisecond
+	devHeartbeat    = 15 * time.Second
+	devReloadPath   = "/__dev/reload"
+	devClientPath   = "/__dev/reload.js"
+)
+
+// devClientScript reconnects automatically and reloads the page when assets change.
+// It is served as a file rather than inline so the CSP does not need 'unsafe-inline'.
+const devClientScript = `(() => {
+  const source = new EventSource("` + devReloadPath + `");
+  source.addEventListener("reload", () => window.location.reload());
+  console.log("[dev] Live reload connected");
+})();
+`
+
+// devReloader watches the working directory and notifies connected browsers over SSE.
+type devReloader struct {
+	fsys    fs.FS
+	clients map[chan struct{}]struct{}
+	done    chan struct{}
+	mu      sync.Mutex
+	closed  bool
+}
+
+func newDevReloader(fsys fs.FS) *devReloader {
+	return &devReloader{
+		fsys:    fsys,
+		clients: make(map[chan struct{}]struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// load rebuilds the asset store from disk with the live reload client injected.
+// Compression is skipped so reloads stay fast.
+func (d *devReloader) load() (*assetStore, error) {
+	store, err := newAssetStore(d.fsys, false)
+	if err != nil {
+		return nil, err
+	}
+	index, ok := store.assets["index.html"]
+	if !ok {
+		return nil, fmt.Errorf("index.html not found")
+	}
+	asset, err := newStaticAsset("index.html", devIndex(index.data), false)
+	if err != nil {
+		return nil, err
+	}
+	store.assets["index.html"] = asset
+	return store, nil
+}
+
+// devIndex makes asset URLs same-origin, so they are loaded from disk rather than
+// the production domain, and injects the live reload client.
+func devIndex(data []byte) []byte {
+	data = htmlAssetPattern.ReplaceAll(data, []byte("${1}/assets/${3}${4}"))
+	snippet := []byte(`<script src="` + devClientPath + `"></script></body>`)
+	return bytes.Replace(data, []byte("</body>"), snippet, 1)
+}
+
+// signature fingerprints the names, sizes and modification times of the served files.
+func (d *devReloader) signature() ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, root := range staticRoots {
+		err := fs.WalkDir(d.fsys, root, func(name string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "%s\x00%d\x00%d\n", name, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+	}
+	return [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+// watch polls for changes until ctx is done, swapping in a fresh asset store and
+// notifying browsers whenever the files change.
+func (d *devReloader) watch(ctx context.Context) {
+	last, err := d.signature()
+	if err != nil {
+		slog.Error("Dev mode failed to scan static files", "error", err)
+	}
+
+	ticker := time.NewTicker(devPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sig, err := d.signature()
+		if err != nil {
+			slog.Error("Dev mode failed to scan static files", "error", err)
+			continue
+		}
+		if sig == last {
+			continue
+		}
+		last = sig
+
+		store, err := d.load()
+		if err != nil {
+			slog.Error("Dev mode failed to reload static files, keeping previous version", "error", err)
+			continue
+		}
+		staticAssets.Store(store)
+		slog.Info("Dev mode static files changed, reloading browsers")
+		d.broadcast()
+	}
+}
+
+func (d *devReloader) subscribe() (chan struct{}, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, false
+	}
+	ch := make(chan struct{}, 1)
+	d.clients[ch] = struct{}{}
+	return ch, true
+}
+
+func (d *devReloader) unsubscribe(ch chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.clients, ch)
+}
+
+func (d *devReloader) broadcast() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for ch := range d.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// A reload is already pending for this client
+		}
+	}
+}
+
+// close disconnects all browsers so server shutdown is not held up by open streams.
+func (d *devReloader) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.done)
+	}
+}
+
+// handleEvents streams reload events to the browser.
+func (d *devReloader) handleEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's WriteTimeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		logFrom(r.Context()).Warn("Dev mode failed to clear write deadline", "error", err)
+	}
+
+	ch, ok := d.subscribe()
+	if !ok {
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer d.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		logFrom(r.Context()).Error("Dev mode streaming not supported", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(devHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var msg string
+		select {
+		case <-r.Context().Done():
+			return
+		case <-d.done:
+			return
+		case <-heartbeat.C:
+			msg = ": heartbeat\n\n"
+		case <-ch:
+			msg = "event: reload\ndata: {}\n\n"
+		}
+		if _, err := fmt.Fprint(w, msg); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func handleDevClient(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := fmt.Fprint(w, devClientScript); err != nil {
+		slog.Error("Failed to write dev client", "error", err)
+	}
+}
+
+// startDevMode serves static files from the working directory, layered under
+// override if it is non-nil, and registers the live reload endpoints.
+func startDevMode(ctx context.Context, mux *http.ServeMux, srv *http.Server, override fs.FS) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	fsys := os.DirFS(dir)
+	if override != nil {
+		fsys = newOverlayFS(override, fsys)
+	}
+	reloader := newDevReloader(fsys)
+	store, err := reloader.load()
+	if err != nil {
+		return fmt.Errorf("load static files from %s: %w", dir, err)
+	}
+	staticAssets.Store(store)
+
+	mux.HandleFunc(devReloadPath, reloader.handleEvents)
+	mux.HandleFunc(devClientPath, handleDevClient)
+	srv.RegisterOnShutdown(reloader.close)
+	go reloader.watch(ctx)
+
+	slog.Info("Dev mode serving static files with live reload", "dir", dir)
+	return nil
+}
+
+// isLocalhost reports whether a Host header refers to the local machine.
+func isLocalhost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
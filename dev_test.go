@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDevFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestDevModeReloadsFromDisk verifies that file changes are served and pushed to browsers.
+func TestDevModeReloadsFromDisk(t *testing.T) {
+	previous := staticAssets.Load()
+	t.Cleanup(func() { staticAssets.Store(previous) })
+
+	dir := t.TempDir()
+	writeDevFile(t, dir, "index.html",
+		`<html><body><script type="module" src="https://ready-to-review.dev/assets/app.js"></script></body></html>`)
+	writeDevFile(t, dir, "assets/app.js", `console.log("v1");`)
+
+	reloader := newDevReloader(os.DirFS(dir))
+	store, err := reloader.load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	staticAssets.Store(store)
+
+	index := string(store.assets["index.html"].data)
+	if !strings.Contains(index, `src="`+devClientPath+`"`) {
+		t.Error("index.html is missing the live reload client")
+	}
+	if strings.Contains(index, "https://ready-to-review.dev/assets/") {
+		t.Error("index.html still loads assets from the production domain")
+	}
+
+	ctx := t.Context()
+	go reloader.watch(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc(reloader.handleEvents))
+	t.Cleanup(srv.Close)
+	t.Cleanup(reloader.close)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("connect to event stream: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // test cleanup
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	// Give the watcher a moment to take its initial snapshot before changing files
+	time.Sleep(2 * devPollInterval)
+	writeDevFile(t, dir, "assets/app.js", `console.log("version 2");`)
+
+	events := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "event: ") {
+				events <- strings.TrimPrefix(scanner.Text(), "event: ")
+				return
+			}
+		}
+	}()
+
+	select {
+	case event := <-events:
+		if event != "reload" {
+			t.Errorf("event = %q, want reload", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event after changing a file")
+	}
+
+	rec := httptest.NewRecorder()
+	serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, "/assets/app.js", http.NoBody))
+	if !strings.Contains(rec.Body.String(), "version 2") {
+		t.Errorf("served app.js = %q, want updated contents", rec.Body.String())
+	}
+
+	// SPA fallback behaves the same as production
+	rec = httptest.NewRecorder()
+	serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, "/u/alice", http.NoBody))
+	if !strings.Contains(rec.Body.String(), devClientPath) {
+		t.Error("SPA fallback did not serve the dev index.html")
+	}
+}
+
+// TestDevModeRelaxesHTTPSForLocalhost verifies HSTS and upgrade-insecure-requests are dropped only on localhost.
+func TestDevModeRelaxesHTTPSForLocalhost(t *testing.T) {
+	*devMode = true
+	t.Cleanup(func() { *devMode = false })
+
+	handler := securityHeaders(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	tests := []struct {
+		host    string
+		relaxed bool
+	}{
+		{host: "localhost:8080", relaxed: true},
+		{host: "127.0.0.1:8080", relaxed: true},
+		{host: "ready-to-review.dev", relaxed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.Host = tt.host
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			upgrades := strings.Contains(rec.Header().Get("Content-Security-Policy"), "upgrade-insecure-requests")
+			hsts := rec.Header().Get("Strict-Transport-Security") != ""
+			if upgrades == tt.relaxed || hsts == tt.relaxed {
+				t.Errorf("upgrade-insecure-requests=%v HSTS=%v, want both %v", upgrades, hsts, !tt.relaxed)
+			}
+		})
+	}
+}
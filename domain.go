@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// The dashboard is served from a base domain: personal dashboards live on the
+// domain itself, org workspaces on its subdomains and OAuth on auth.<domain>.
+const (
+	defaultBaseDomain = "ready-to-review.dev"
+	clientConfigPath  = "/config.json"
+)
+
+// isOurHost reports whether host is the base domain or one of its subdomains.
+func isOurHost(host string) bool {
+	return host == *baseDomain || strings.HasSuffix(host, "."+*baseDomain)
+}
+
+// parseHostList parses a comma-separated list of host names, where
+// *.example.com matches any subdomain of example.com.
+func parseHostList(list string) ([]string, error) {
+	var hosts []string
+	for entry := range strings.SplitSeq(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		name := strings.TrimPrefix(entry, "*.")
+		if strings.ContainsAny(name, "*/:@ ") || !strings.Contains(name, ".") && name != "localhost" {
+			return nil, fmt.Errorf("%q is not a host name such as api.github.com or *.googleapis.com", entry)
+		}
+		hosts = append(hosts, entry)
+	}
+	return hosts, nil
+}
+
+// matchHost reports whether host is in a list from parseHostList.
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBaseDomain checks that domain is a bare lower-case host name such as
+// "example.com", without a scheme, port or path.
+func validateBaseDomain(domain string) error {
+	if domain == "" {
+		return fmt.Errorf("base domain is empty")
+	}
+	if domain != strings.ToLower(domain) {
+		return fmt.Errorf("base domain %q must be lower case", domain)
+	}
+	u, err := url.Parse("https://" + domain)
+	if err != nil || u.Host != domain || u.Port() != "" || u.User != nil {
+		return fmt.Errorf("base domain %q must be a host name such as example.com, without scheme, port or path", domain)
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("base domain %q needs at least two labels so workspaces can be subdomains", domain)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") ||
+			strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return fmt.Errorf("base domain %q has invalid label %q", domain, label)
+		}
+	}
+	return nil
+}
+
+// newCSRFProtection trusts requests from the base domain, all of its subdomains
+// and localhost.
+func newCSRFProtection() (*http.CrossOriginProtection, error) {
+	csrf := http.NewCrossOriginProtection()
+	// Trust requests from our own domain and all subdomains
+	if err := csrf.AddTrustedOrigin("https://" + *baseDomain); err != nil {
+		return nil, fmt.Errorf("base domain: %w", err)
+	}
+	if err := csrf.AddTrustedOrigin("https://*." + *baseDomain); err != nil {
+		return nil, fmt.Errorf("subdomains: %w", err)
+	}
+	// Allow localhost for development (covers all ports)
+	if err := csrf.AddTrustedOrigin("http://localhost"); err != nil {
+		return nil, fmt.Errorf("localhost: %w", err)
+	}
+	// Origins in --allowed-origins are trusted on API routes by corsPolicy.protect
+	return csrf, nil
+}
+
+// clientConfig holds the deployment settings the frontend needs, so it does not
+// have to hardcode them.
+type clientConfig struct {
+	BaseDomain         string   `json:"base_domain"`
+	AuthHost           string   `json:"auth_host"`
+	WorkspaceMode      string   `json:"workspace_mode"`
+	ReservedSubdomains []string `json:"reserved_subdomains"`
+}
+
+func handleClientConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config := clientConfig{
+		BaseDomain:         *baseDomain,
+		AuthHost:           authHost(),
+		WorkspaceMode:      *workspaceMode,
+		ReservedSubdomains: slices.Sorted(maps.Keys(reservedSubdomains)),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if err := json.NewEncoder(w).Encode(config); err != nil {
+		logFrom(r.Context()).Error("Failed to encode client config", "error", err)
+	}
+}
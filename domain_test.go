@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useBaseDomain serves the dashboard from domain for the rest of the test.
+func useBaseDomain(t testing.TB, domain string) {
+	t.Helper()
+	if err := validateBaseDomain(domain); err != nil {
+		t.Fatalf("validateBaseDomain(%q) error = %v", domain, err)
+	}
+	prevDomain, prevRedirect, prevCSRF, prevAssets := *baseDomain, *redirectURI, csrfProtection, staticAssets.Load()
+	t.Cleanup(func() {
+		*baseDomain, *redirectURI, csrfProtection = prevDomain, prevRedirect, prevCSRF
+		staticAssets.Store(prevAssets)
+	})
+
+	*baseDomain = domain
+	*redirectURI = "https://" + authHost() + "/oauth/callback"
+	csrf, err := newCSRFProtection()
+	if err != nil {
+		t.Fatalf("newCSRFProtection() error = %v", err)
+	}
+	csrfProtection = csrf
+	store, err := newAssetStore(staticFiles, false)
+	if err != nil {
+		t.Fatalf("newAssetStore() error = %v", err)
+	}
+	staticAssets.Store(store)
+}
+
+// useFakeGitHub points OAuth at a local server that issues testToken for user login.
+func useFakeGitHub(t *testing.T, login string) {
+	t.Helper()
+	resetBreakers(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.FormValue("redirect_uri"), *redirectURI; got != want {
+			t.Errorf("token exchange redirect_uri = %q, want %q", got, want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(oauthTokenResponse{AccessToken: testToken, TokenType: "bearer"}) //nolint:errcheck // test server
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			http.Error(w, "Bad credentials", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(githubUser{Login: login, ID: 1}) //nolint:errcheck // test server
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	prevURL, prevAPI, prevID, prevSecret := githubURL, githubAPIURL, *clientID, *clientSecret
+	t.Cleanup(func() {
+		githubURL, githubAPIURL, *clientID, *clientSecret = prevURL, prevAPI, prevID, prevSecret
+	})
+	githubURL, githubAPIURL = srv.URL, srv.URL
+	*clientID, *clientSecret = "test_client_id", "test_secret"
+}
+
+// TestOAuthFlowUnderCustomDomain runs login, callback and exchange on a self-hosted domain.
+func TestOAuthFlowUnderCustomDomain(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	useFakeGitHub(t, "alice")
+	setupAuthCodeStore(t)
+	exchangeRateLimiter = &rateLimiter{requests: make(map[string][]time.Time), limit: *rateLimitRequests, window: *rateLimitWindow}
+	handler := securityHeaders(newMux(nil))
+
+	var cookies []*http.Cookie
+	do := func(method, target string, body string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Forwarded-Proto", "https")
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		cookies = append(cookies, rec.Result().Cookies()...)
+		return rec
+	}
+
+	// A workspace sends the browser to the auth subdomain of the configured domain
+	rec := do(http.MethodGet, "https://acme.example.test/oauth/login", "", nil)
+	wantAuth := "https://auth.example.test/oauth/login?return_to=" + url.QueryEscape("https://acme.example.test/")
+	if got := rec.Header().Get("Location"); rec.Code != http.StatusFound || got != wantAuth {
+		t.Fatalf("login redirect = %d %q, want %d %q", rec.Code, got, http.StatusFound, wantAuth)
+	}
+
+	// The auth subdomain starts OAuth with the matching callback
+	rec = do(http.MethodGet, wantAuth, "", nil)
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || rec.Code != http.StatusFound {
+		t.Fatalf("authorize redirect = %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := authorize.Query().Get("redirect_uri"); got != "https://auth.example.test/oauth/callback" {
+		t.Errorf("redirect_uri = %q, want the example.test callback", got)
+	}
+
+	// GitHub sends the browser back with a code; the server hands out a one-time auth code
+	callback := "https://auth.example.test/oauth/callback?code=gh-code&state=" + url.QueryEscape(authorize.Query().Get("state"))
+	rec = do(http.MethodGet, callback, "", nil)
+	location := rec.Header().Get("Location")
+	destination, fragment, _ := strings.Cut(location, "#auth_code=")
+	if rec.Code != http.StatusFound || destination != "https://acme.example.test/" || fragment == "" {
+		t.Fatalf("callback redirect = %d %q, want https://acme.example.test/#auth_code=...", rec.Code, location)
+	}
+	authCode, err := url.QueryUnescape(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Exchanges from the default domain are now cross-origin
+	exchangeBody := `{"auth_code":"` + authCode + `"}`
+	rec = do(http.MethodPost, "https://acme.example.test/oauth/exchange", exchangeBody, http.Header{
+		"Origin": {"https://acme." + defaultBaseDomain}, "Sec-Fetch-Site": {"cross-site"}, "Content-Type": {"application/json"},
+	})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("exchange from %s status = %d, want %d", defaultBaseDomain, rec.Code, http.StatusForbidden)
+	}
+
+	// The workspace redeems the auth code from a sibling subdomain
+	rec = do(http.MethodPost, "https://acme.example.test/oauth/exchange", exchangeBody, http.Header{
+		"Origin": {"https://example.test"}, "Sec-Fetch-Site": {"same-site"}, "Content-Type": {"application/json"},
+	})
+	var resp struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("exchange = %d %s", rec.Code, rec.Body)
+	}
+	if resp.Token != testToken || resp.Username != "alice" {
+		t.Errorf("exchange = %+v, want alice's token", resp)
+	}
+
+	// The page itself loads assets from, and only allows, the configured domain
+	rec = do(http.MethodGet, "https://acme.example.test/", "", nil)
+	csp := rec.Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "script-src 'self' https://example.test") || strings.Contains(csp, defaultBaseDomain) {
+		t.Errorf("CSP = %q, want the example.test origin only", csp)
+	}
+	index := rec.Body.String()
+	if !strings.Contains(index, `src="https://example.test/assets/app.`) || strings.Contains(index, defaultBaseDomain) {
+		t.Error("index.html does not load everything from example.test")
+	}
+
+	rec = do(http.MethodGet, "https://example.test/assets/app.js", "", http.Header{"Origin": {"https://acme.example.test"}})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://acme.example.test" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the workspace origin", got)
+	}
+	rec = do(http.MethodGet, "https://example.test/assets/app.js", "", http.Header{"Origin": {"https://acme." + defaultBaseDomain}})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q for a foreign origin, want none", got)
+	}
+}
+
+// TestValidateReturnToURLCustomDomain verifies return targets follow the configured domain.
+func TestValidateReturnToURLCustomDomain(t *testing.T) {
+	useBaseDomain(t, "dash.corp.example")
+
+	tests := []struct {
+		returnTo string
+		valid    bool
+	}{
+		{"https://dash.corp.example/", true},
+		{"https://acme.dash.corp.example/changelog", true},
+		{"https://" + defaultBaseDomain + "/", false},
+		{"https://acme." + defaultBaseDomain + "/", false},
+		{"https://evil.acme.dash.corp.example/", false},
+		{"https://xn--80ak6aa92e.dash.corp.example/", false},
+		{"https://dash.corp.example.evil.com/", false},
+	}
+	for _, tt := range tests {
+		if got := validateReturnToURL(tt.returnTo); (got != "") != tt.valid {
+			t.Errorf("validateReturnToURL(%q) = %q, want valid=%v", tt.returnTo, got, tt.valid)
+		}
+	}
+}
+
+// TestClientConfig verifies the settings the frontend reads at startup.
+func TestClientConfig(t *testing.T) {
+	useBaseDomain(t, "example.test")
+
+	rec := httptest.NewRecorder()
+	handleClientConfig(rec, httptest.NewRequest(http.MethodGet, clientConfigPath, http.NoBody))
+	var config clientConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &config); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	if config.BaseDomain != "example.test" || config.AuthHost != "auth.example.test" {
+		t.Errorf("config = %+v, want example.test", config)
+	}
+	if len(config.ReservedSubdomains) == 0 {
+		t.Error("config has no reserved subdomains")
+	}
+}
+
+// TestValidateBaseDomain verifies misconfigured domains are rejected at startup.
+func TestValidateBaseDomain(t *testing.T) {
+	for _, domain := range []string{"example.com", "dash.example.co.uk", "xn--bcher-kva.example"} {
+		if err := validateBaseDomain(domain); err != nil {
+			t.Errorf("validateBaseDomain(%q) error = %v", domain, err)
+		}
+	}
+	for _, domain := range []string{"", "localhost", "https://example.com", "example.com:8443", "example.com/app", "Example.com", "-bad.example", "a..example"} {
+		if err := validateBaseDomain(domain); err == nil {
+			t.Errorf("validateBaseDomain(%q) succeeded, want error", domain)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// errEgressDenied is returned for requests to hosts outside --egress-allowed-hosts.
+var errEgressDenied = errors.New("egress to host not allowed")
+
+// egressAllowlist holds the parsed --egress-allowed-hosts; empty allows any host.
+var egressAllowlist []string
+
+// egressProxy picks the proxy for each outbound request after refusing hosts
+// outside the allowlist. It is the Proxy of every outbound transport;
+// setupEgress replaces it, and the default honours the standard proxy
+// environment variables.
+var egressProxy = http.ProxyFromEnvironment
+
+// egressRoots is the system roots plus --egress-ca-file, or nil to use the
+// system roots alone.
+var egressRoots *x509.CertPool
+
+// egressAllowed reports whether host may be contacted.
+func egressAllowed(host string) bool {
+	return len(egressAllowlist) == 0 || matchHost(egressAllowlist, host)
+}
+
+// parseEgressProxy parses --egress-proxy, adding the proxy credentials. Only
+// http and https proxies are supported; credentials belong in the separate
+// settings so they are redacted from --print-config.
+func parseEgressProxy(raw, user, password string) (*url.URL, error) {
+	if raw == "" {
+		if user != "" || password != "" {
+			return nil, errors.New("proxy credentials are set without --egress-proxy")
+		}
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("%q is not a proxy URL such as http://proxy.internal:3128", raw)
+	}
+	if u.User != nil {
+		return nil, errors.New("put proxy credentials in --egress-proxy-user and --egress-proxy-password, not the URL")
+	}
+	if user != "" {
+		u.User = url.UserPassword(user, password)
+	}
+	return u, nil
+}
+
+// loadCABundle returns the system roots plus the certificates in the PEM file.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		slog.Warn("System certificate pool unavailable, trusting only the CA bundle", "error", err)
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s contains no PEM certificates", path)
+	}
+	return roots, nil
+}
+
+// setupEgress applies the proxy, CA bundle and allowlist settings to the shared
+// outbound transport and to http.DefaultTransport, which covers libraries that
+// use the default client. It must run before any outbound call.
+func setupEgress() error {
+	allowed, err := parseHostList(*egressAllowedHosts)
+	if err != nil {
+		return fmt.Errorf("egress-allowed-hosts: %w", err)
+	}
+	proxyURL, err := parseEgressProxy(*egressProxyURL, *egressProxyUser, *egressProxyPassword)
+	if err != nil {
+		return fmt.Errorf("egress-proxy: %w", err)
+	}
+	var roots *x509.CertPool
+	if *egressCAFile != "" {
+		if roots, err = loadCABundle(*egressCAFile); err != nil {
+			return fmt.Errorf("egress-ca-file: %w", err)
+		}
+	}
+
+	pickProxy := http.ProxyFromEnvironment
+	if proxyURL != nil {
+		// NO_PROXY still applies, and localhost is never proxied
+		proxies := (&httpproxy.Config{HTTPProxy: proxyURL.String(), HTTPSProxy: proxyURL.String(), NoProxy: os.Getenv("NO_PROXY")}).ProxyFunc()
+		pickProxy = func(r *http.Request) (*url.URL, error) { return proxies(r.URL) }
+	}
+	egressAllowlist, egressRoots = allowed, roots
+	egressProxy = func(r *http.Request) (*url.URL, error) {
+		if err := checkEgress(r); err != nil {
+			return nil, err
+		}
+		return pickProxy(r)
+	}
+
+	transports := []*http.Transport{outboundTransport}
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		t.Proxy = outboundTransport.Proxy
+		transports = append(transports, t)
+	}
+	for _, t := range transports {
+		t.CloseIdleConnections()
+		if roots != nil {
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			// Also used for the TLS connection to an https proxy
+			t.TLSClientConfig.RootCAs = roots
+		}
+	}
+
+	if proxyURL != nil || roots != nil || len(allowed) > 0 {
+		slog.Info("Egress configured", "proxy", proxyHost(proxyURL), "ca_file", *egressCAFile, "allowed_hosts", allowed)
+	}
+	return nil
+}
+
+// checkEgress refuses requests to hosts outside the allowlist.
+func checkEgress(r *http.Request) error {
+	if host := r.URL.Hostname(); !egressAllowed(host) {
+		egressDenials.Inc()
+		slog.Warn("Refused outbound request to a host outside the egress allowlist", securityEvent, "host", host)
+		return fmt.Errorf("%w: %s", errEgressDenied, host)
+	}
+	return nil
+}
+
+// proxyHost describes a proxy without its credentials.
+func proxyHost(u *url.URL) string {
+	if u == nil {
+		return "environment"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Probe endpoints. /health is kept for existing monitors.
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+
+	// readinessTimeout bounds a single check.
+	readinessTimeout = 5 * time.Second
+	// githubCheckInterval is how long a GitHub reachability result is reused,
+	// so frequent probes make at most one request per interval.
+	githubCheckInterval = 30 * time.Second
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// currentBuild reads the module version and VCS stamp embedded by go build.
+var currentBuild = sync.OnceValue(func() buildInfo {
+	info := buildInfo{Version: "(devel)"}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = bi.GoVersion
+	if bi.Main.Version != "" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.BuildTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		default:
+		}
+	}
+	return info
+})
+
+// readinessCheck is a dependency that must work before we take traffic.
+// Results are reused for interval; zero means check on every probe.
+type readinessCheck struct {
+	name     string
+	interval time.Duration
+	check    func(context.Context) error
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// checkResult is one check's entry in the /readyz response.
+type checkResult struct {
+	OK        bool      `json:"ok"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// result runs the check unless a cached result is still fresh. Concurrent
+// probes wait for the one in flight instead of starting their own. The check
+// does not stop when the prober gives up, since its result is shared and a
+// cancelled probe must not be cached as a failure.
+func (c *readinessCheck) result(ctx context.Context) checkResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checkedAt.IsZero() || time.Since(c.checkedAt) >= c.interval {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), readinessTimeout)
+		c.err = c.check(ctx)
+		cancel()
+		c.checkedAt = time.Now()
+	}
+	result := checkResult{OK: c.err == nil, CheckedAt: c.checkedAt}
+	if c.err != nil {
+		result.Error = c.err.Error()
+	}
+	return result
+}
+
+// readinessChecks lists the dependencies checked by /readyz.
+var readinessChecks = []*readinessCheck{
+	{name: "client_secret", check: checkClientSecret},
+	{name: "auth_code_store", check: checkAuthCodeStore},
+	{name: "rate_limiter", check: checkRateLimiter},
+	{name: "github", interval: githubCheckInterval, check: checkGitHub},
+}
+
+func checkClientSecret(context.Context) error {
+	if *clientID == "" || *clientSecret == "" {
+		return errors.New("OAuth client ID or secret not configured")
+	}
+	return nil
+}
+
+// checkAuthCodeStore verifies the store's lock can be taken and that tokens
+// can be sealed and opened.
+func checkAuthCodeStore(ctx context.Context) error {
+	if err := lockWithin(ctx, &authCodesMutex); err != nil {
+		return fmt.Errorf("auth code store: %w", err)
+	}
+	authCodesMutex.Unlock()
+
+	if authCodeSealer == nil {
+		return errors.New("auth code sealer not initialized")
+	}
+	const probe = "readiness"
+	sealed, err := authCodeSealer.seal([]byte(probe), probe)
+	if err != nil {
+		return fmt.Errorf("seal: %w", err)
+	}
+	if _, err := authCodeSealer.open(sealed, probe); err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	return nil
+}
+
+func checkRateLimiter(ctx context.Context) error {
+	if exchangeRateLimiter == nil {
+		return errors.New("rate limiter not initialized")
+	}
+	if err := lockWithin(ctx, &exchangeRateLimiter.mu); err != nil {
+		return fmt.Errorf("rate limiter: %w", err)
+	}
+	exchangeRateLimiter.mu.Unlock()
+	return nil
+}
+
+// checkGitHub verifies GitHub's OAuth endpoint answers. Any response below 500
+// means it is reachable; redirects are not followed.
+func checkGitHub(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, githubURL+"/login/oauth/authorize", http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("GitHub unreachable: %w", err)
+	}
+	if err := resp.Body.Close(); err != nil {
+		logFrom(ctx).Warn("Failed to close response body", "error", err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("GitHub returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// lockWithin takes mu, giving up when ctx is done so a stuck store fails the
+// check instead of hanging the probe.
+func lockWithin(ctx context.Context, mu *sync.Mutex) error {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for !mu.TryLock() {
+		select {
+		case <-ctx.Done():
+			return errors.New("lock not acquired before deadline")
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// handleLiveness reports that the process is serving requests. It checks no
+// dependencies, so a GitHub outage never gets the server restarted.
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, r, http.StatusOK, struct {
+		Status string    `json:"status"`
+		Time   time.Time `json:"timestamp"`
+		buildInfo
+	}{Status: "ok", Time: time.Now(), buildInfo: currentBuild()})
+}
+
+// handleReadiness runs the readiness checks and answers 503 if any fails. The
+// GitHub circuit breakers are reported alongside but never fail the probe.
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	results := make(map[string]checkResult, len(readinessChecks))
+	status, code := "ready", http.StatusOK
+	for _, c := range readinessChecks {
+		result := c.result(r.Context())
+		results[c.name] = result
+		if !result.OK {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	if code != http.StatusOK {
+		logFrom(r.Context()).Warn("Readiness check failed", "checks", results)
+	}
+	writeProbe(w, r, code, struct {
+		Status   string                 `json:"status"`
+		Time     time.Time              `json:"timestamp"`
+		Checks   map[string]checkResult `json:"checks"`
+		Circuits map[string]string      `json:"github_circuits"`
+		buildInfo
+	}{Status: status, Time: time.Now(), Checks: results, Circuits: githubCircuitStates(), buildInfo: currentBuild()})
+}
+
+func writeProbe(w http.ResponseWriter, r *http.Request, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logFrom(r.Context()).Error("Failed to encode probe response", "error", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetReadiness forgets cached readiness results before and after the test.
+func resetReadiness(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		for _, c := range readinessChecks {
+			c.mu.Lock()
+			c.checkedAt, c.err = time.Time{}, nil
+			c.mu.Unlock()
+		}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+type readinessResponse struct {
+	Status   string                 `json:"status"`
+	Version  string                 `json:"version"`
+	Checks   map[string]checkResult `json:"checks"`
+	Circuits map[string]string      `json:"github_circuits"`
+}
+
+func getReadiness(t *testing.T, handler http.Handler) (int, readinessResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, readinessPath, http.NoBody))
+	var resp readinessResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode readiness: %v: %s", err, rec.Body)
+	}
+	return rec.Code, resp
+}
+
+// TestLiveness verifies /healthz reports build info without checking dependencies.
+func TestLiveness(t *testing.T) {
+	prevSecret := *clientSecret
+	t.Cleanup(func() { *clientSecret = prevSecret })
+	*clientSecret = ""
+
+	rec := httptest.NewRecorder()
+	newMux(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, livenessPath, http.NoBody))
+	var resp struct {
+		Status    string `json:"status"`
+		Version   string `json:"version"`
+		GoVersion string `json:"go_version"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("liveness = %d %s", rec.Code, rec.Body)
+	}
+	if resp.Status != "ok" || resp.Version == "" || resp.Version == "1.0.0" || resp.GoVersion == "" {
+		t.Errorf("liveness = %+v, want build info from the binary", resp)
+	}
+}
+
+// TestReadiness verifies dependency checks and that GitHub results are cached.
+func TestReadiness(t *testing.T) {
+	resetReadiness(t)
+	setupAuthCodeStore(t)
+	exchangeRateLimiter = &rateLimiter{requests: make(map[string][]time.Time), limit: *rateLimitRequests, window: *rateLimitWindow}
+	prevURL, prevID, prevSecret := githubURL, *clientID, *clientSecret
+	t.Cleanup(func() { githubURL, *clientID, *clientSecret = prevURL, prevID, prevSecret })
+	*clientID, *clientSecret = "test_client_id", "test_secret"
+
+	var hits atomic.Int32
+	var failing atomic.Bool
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/login/oauth/authorize" {
+			t.Errorf("readiness probed %s", r.URL.Path)
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		http.Redirect(w, r, "/login", http.StatusFound)
+	}))
+	t.Cleanup(github.Close)
+	githubURL = github.URL
+	handler := newMux(nil)
+
+	code, resp := getReadiness(t, handler)
+	if code != http.StatusOK || resp.Status != "ready" {
+		t.Fatalf("readiness = %d %+v, want ready", code, resp)
+	}
+	for _, name := range []string{"client_secret", "auth_code_store", "rate_limiter", "github"} {
+		if !resp.Checks[name].OK {
+			t.Errorf("check %s = %+v, want ok", name, resp.Checks[name])
+		}
+	}
+
+	// An open circuit breaker is reported but does not fail readiness
+	resetBreakers(t)
+	breaker := githubBreakers[githubCallUserInfo]
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now()
+	breaker.setState(breakerOpen)
+	breaker.mu.Unlock()
+	code, resp = getReadiness(t, handler)
+	if code != http.StatusOK || resp.Circuits[githubCallUserInfo] != "open" || resp.Circuits[githubCallTokenExchange] != "closed" {
+		t.Errorf("readiness with an open breaker = %d %+v, want 200 reporting it open", code, resp.Circuits)
+	}
+
+	// GitHub breaks, but probes within the interval reuse the cached result
+	failing.Store(true)
+	for range 5 {
+		if code, _ := getReadiness(t, handler); code != http.StatusOK {
+			t.Fatalf("cached readiness = %d, want %d", code, http.StatusOK)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Errorf("GitHub probed %d times, want 1", got)
+	}
+
+	// Once the cached result expires the outage shows
+	for _, c := range readinessChecks {
+		if c.name == "github" {
+			c.mu.Lock()
+			c.checkedAt = time.Now().Add(-githubCheckInterval)
+			c.mu.Unlock()
+		}
+	}
+	code, resp = getReadiness(t, handler)
+	if code != http.StatusServiceUnavailable || resp.Checks["github"].OK || resp.Checks["github"].Error == "" {
+		t.Errorf("readiness = %d %+v, want github failure", code, resp.Checks["github"])
+	}
+
+	// A missing secret fails readiness but not liveness
+	failing.Store(false)
+	resetReadiness(t)
+	*clientSecret = ""
+	if code, resp := getReadiness(t, handler); code != http.StatusServiceUnavailable || resp.Checks["client_secret"].OK {
+		t.Errorf("readiness without secret = %d %+v, want client_secret failure", code, resp.Checks)
+	}
+}
+
+// TestReadinessIgnoresProberCancel verifies a prober that disconnects does not
+// leave a cached failure behind for the probes that follow.
+func TestReadinessIgnoresProberCancel(t *testing.T) {
+	var runs atomic.Int32
+	check := &readinessCheck{name: "slow", interval: githubCheckInterval, check: func(ctx context.Context) error {
+		runs.Add(1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			return nil
+		}
+	}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if result := check.result(ctx); !result.OK {
+		t.Errorf("result for a cancelled prober = %+v, want ok", result)
+	}
+	if result := check.result(t.Context()); !result.OK || runs.Load() != 1 {
+		t.Errorf("next probe = %+v after %d runs, want the cached success", result, runs.Load())
+	}
+}
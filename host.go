@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Cloudflare worker (workers/proxy.js) forwards wildcard subdomains to us
+// with the host the browser asked for in X-Original-Host, signed with the
+// shared --original-host-secret.
+const (
+	originalHostHeader          = "X-Original-Host"
+	originalHostTimestampHeader = "X-Original-Host-Timestamp"
+	originalHostSignatureHeader = "X-Original-Host-Signature"
+
+	// originalHostMaxSkew is how far a signature's timestamp may be from our
+	// clock, so captured headers cannot be replayed for long.
+	originalHostMaxSkew = 5 * time.Minute
+)
+
+// Reasons a request's host is not trusted, used as metric labels.
+const (
+	hostUnsignedOriginal = "original_host_unsigned"
+	hostBadSignature     = "original_host_bad_signature"
+	hostExpiredSignature = "original_host_expired"
+	hostUnknown          = "unknown_host"
+)
+
+// signOriginalHost returns the hex HMAC-SHA256 of "<host>\n<unix timestamp>",
+// matching signOriginalHost in workers/proxy.js.
+func signOriginalHost(secret []byte, host string, timestamp int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(host + "\n" + strconv.FormatInt(timestamp, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyOriginalHost checks the signature on r's X-Original-Host. It returns ""
+// if the header is signed by the worker, or the reason it is not trusted.
+func verifyOriginalHost(r *http.Request, now time.Time) string {
+	if *originalHostSecret == "" {
+		return hostUnsignedOriginal
+	}
+	timestamp := r.Header.Get(originalHostTimestampHeader)
+	signature := r.Header.Get(originalHostSignatureHeader)
+	if timestamp == "" || signature == "" {
+		return hostUnsignedOriginal
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return hostBadSignature
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil {
+		return hostBadSignature
+	}
+	want, _ := hex.DecodeString(signOriginalHost([]byte(*originalHostSecret), r.Header.Get(originalHostHeader), ts)) //nolint:errcheck // our own hex
+	if !hmac.Equal(got, want) {
+		return hostBadSignature
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > originalHostMaxSkew || skew < -originalHostMaxSkew {
+		return hostExpiredSignature
+	}
+	return ""
+}
+
+// isProbePath reports whether path is a health probe. Probes are sent to the
+// instance's own address, so they are exempt from the Host allowlist.
+func isProbePath(path string) bool {
+	return path == "/health" || path == livenessPath || path == readinessPath
+}
+
+// checkHost drops X-Original-Host unless the worker signed it, then rejects
+// requests for hosts we do not serve, defending against DNS rebinding. The
+// base domain, its subdomains, localhost and --allowed-hosts are served.
+func checkHost(next http.Handler) http.Handler {
+	extraHosts, _ := parseHostList(*allowedHosts) //nolint:errcheck // checked by validateConfig
+	if *originalHostSecret == "" {
+		slog.Warn("No --original-host-secret configured; X-Original-Host headers will be ignored")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if original := r.Header.Get(originalHostHeader); original != "" {
+			if reason := verifyOriginalHost(r, time.Now()); reason != "" {
+				logFrom(r.Context()).Warn("Ignoring untrusted X-Original-Host", securityEvent, "original_host", original, "reason", reason)
+				hostRejections.WithLabelValues(reason).Inc()
+				r.Header.Del(originalHostHeader)
+			}
+		}
+		r.Header.Del(originalHostTimestampHeader)
+		r.Header.Del(originalHostSignatureHeader)
+
+		host := r.Header.Get(originalHostHeader)
+		if host == "" {
+			host = r.Host
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if !isProbePath(r.URL.Path) && !isOurHost(host) && !isLocalhost(host) && !matchHost(extraHosts, host) {
+			logFrom(r.Context()).Warn("Rejected request for unknown host", securityEvent, "host", host)
+			hostRejections.WithLabelValues(hostUnknown).Inc()
+			http.Error(w, "Unknown host", http.StatusMisdirectedRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
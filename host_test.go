@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testOriginalHostSecret = "0123456789abcdef0123456789abcdef"
+
+// useOriginalHostSecret sets the worker's shared secret and extra hosts for the test.
+func useOriginalHostSecret(t *testing.T, secret, hosts string) {
+	t.Helper()
+	prevSecret, prevHosts := *originalHostSecret, *allowedHosts
+	t.Cleanup(func() { *originalHostSecret, *allowedHosts = prevSecret, prevHosts })
+	*originalHostSecret, *allowedHosts = secret, hosts
+}
+
+// signedRequest returns a request through the worker for host, signed at ts.
+func signedRequest(target, host string, ts time.Time, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+	req.Host = "dashboard-123.a.run.app"
+	req.Header.Set(originalHostHeader, host)
+	req.Header.Set(originalHostTimestampHeader, strconv.FormatInt(ts.Unix(), 10))
+	req.Header.Set(originalHostSignatureHeader, signOriginalHost([]byte(secret), host, ts.Unix()))
+	return req
+}
+
+// TestSignOriginalHostMatchesWorker pins the signature format shared with
+// workers/proxy.js, computed there for the same inputs.
+func TestSignOriginalHostMatchesWorker(t *testing.T) {
+	got := signOriginalHost([]byte(testOriginalHostSecret), "acme.example.test", 1700000000)
+	if want := "520794f10bd78d50b9f208245a726e67a8e099c581dc2971eedb41146c3244c7"; got != want {
+		t.Errorf("signOriginalHost() = %s, want %s", got, want)
+	}
+}
+
+// TestCheckHost verifies only signed X-Original-Host values are trusted and
+// requests for unknown hosts are rejected.
+func TestCheckHost(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	useOriginalHostSecret(t, testOriginalHostSecret, "*.a.run.app")
+	buf := useTestLogger(t)
+	var seen string
+	handler := checkHost(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(originalHostHeader)
+		if r.Header.Get(originalHostSignatureHeader) != "" || r.Header.Get(originalHostTimestampHeader) != "" {
+			t.Error("signature headers passed on to the handler")
+		}
+	}))
+
+	now := time.Now()
+	forged := signedRequest("/", "acme.example.test", now, testOriginalHostSecret)
+	forged.Header.Set(originalHostHeader, "evil.example.test")
+	unsigned := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	unsigned.Host = "example.test"
+	unsigned.Header.Set(originalHostHeader, "acme.example.test")
+	rebound := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	rebound.Host = "attacker.test:8080"
+	probe := httptest.NewRequest(http.MethodGet, readinessPath, http.NoBody)
+	probe.Host = "10.0.0.7:8080"
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		code     int
+		original string
+	}{
+		{name: "signed", req: signedRequest("/", "acme.example.test", now, testOriginalHostSecret), code: http.StatusOK, original: "acme.example.test"},
+		{name: "unsigned", req: unsigned, code: http.StatusOK},
+		{name: "forged host", req: forged, code: http.StatusOK},
+		{name: "wrong secret", req: signedRequest("/", "acme.example.test", now, "another-secret-another-secret-xx"), code: http.StatusOK},
+		{name: "replayed", req: signedRequest("/", "acme.example.test", now.Add(-time.Hour), testOriginalHostSecret), code: http.StatusOK},
+		{name: "signed unknown host", req: signedRequest("/", "attacker.test", now, testOriginalHostSecret), code: http.StatusMisdirectedRequest},
+		{name: "rebinding", req: rebound, code: http.StatusMisdirectedRequest},
+		{name: "probe by IP", req: probe, code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		seen = ""
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tt.req)
+		if rec.Code != tt.code || seen != tt.original {
+			t.Errorf("%s: status %d, X-Original-Host %q; want %d, %q", tt.name, rec.Code, seen, tt.code, tt.original)
+		}
+	}
+
+	reasons := map[string]int{}
+	for _, line := range logLines(t, buf) {
+		if reason, ok := line["reason"].(string); ok && line["security"] == true {
+			reasons[reason]++
+		}
+	}
+	want := map[string]int{hostUnsignedOriginal: 1, hostBadSignature: 2, hostExpiredSignature: 1}
+	for reason, n := range want {
+		if reasons[reason] != n {
+			t.Errorf("logged %d %s events, want %d (all: %v)", reasons[reason], reason, n, reasons)
+		}
+	}
+}
+
+// TestCheckHostWithoutSecret verifies X-Original-Host is never trusted when no
+// secret is configured.
+func TestCheckHostWithoutSecret(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	useOriginalHostSecret(t, "", "")
+	var seen string
+	handler := checkHost(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(originalHostHeader)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("/", "acme.example.test", time.Now(), ""))
+	if seen != "" {
+		t.Errorf("X-Original-Host = %q, want it dropped", seen)
+	}
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("status = %d, want %d for the unlisted run.app host", rec.Code, http.StatusMisdirectedRequest)
+	}
+}
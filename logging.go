@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// logLevel is the minimum level written, set by --log-level.
+var logLevel = new(slog.LevelVar)
+
+func init() {
+	// The zero LevelVar is info
+	flag.TextVar(logLevel, "log-level", new(slog.LevelVar), "Minimum log level: debug, info, warn or error")
+}
+
+// securityEvent marks log lines worth alerting on.
+var securityEvent = slog.Bool("security", true)
+
+// maxRequestIDLength bounds client supplied request IDs.
+const maxRequestIDLength = 64
+
+// Attribute keys whose values are never logged: exact OAuth parameter names,
+// and any key with one of the credential words as a part, e.g. client_secret.
+var (
+	sensitiveKeys     = []string{"code", "auth_code", "state"}
+	sensitiveKeyWords = []string{"token", "secret", "password", "authorization", "cookie"}
+)
+
+// sensitiveValues matches credentials embedded in free text: GitHub tokens,
+// bearer credentials and OAuth query parameters.
+var sensitiveValues = regexp.MustCompile(
+	`\bgh[pousr]_[A-Za-z0-9_]{16,}|(?i:bearer\s+)[^\s"]+|(?i:\b(?:code|state|token|access_token|client_secret|auth_code)=)[^&\s"#]+`)
+
+// setupLogging makes a JSON slog handler the default for both slog and the log
+// package, with secrets redacted from every line.
+func setupLogging(w io.Writer) {
+	slog.SetDefault(slog.New(newLogHandler(w)))
+}
+
+func newLogHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevel, ReplaceAttr: redactAttr})
+}
+
+// redactAttr hides values of sensitive keys and credentials found in any
+// message, string or error.
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.MessageKey && isSensitiveKey(a.Key) {
+		if a.Value.Kind() == slog.KindString && a.Value.String() == "" {
+			return a
+		}
+		return slog.String(a.Key, redactedValue)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	default:
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if slices.Contains(sensitiveKeys, key) {
+		return true
+	}
+	for part := range strings.FieldsFuncSeq(key, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if slices.Contains(sensitiveKeyWords, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString replaces credentials in s, keeping the parameter name or prefix
+// so the line stays readable.
+func redactString(s string) string {
+	return sensitiveValues.ReplaceAllStringFunc(s, func(match string) string {
+		if name, _, ok := strings.Cut(match, "="); ok {
+			return name + "=" + redactedValue
+		}
+		if fields := strings.Fields(match); len(fields) == 2 {
+			return fields[0] + " " + redactedValue
+		}
+		return match[:4] + redactedValue
+	})
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// logScope is the request-scoped logger. Handlers add attributes such as the
+// user once they are known, and the access log line includes them.
+type logScope struct {
+	mu     sync.Mutex
+	logger *slog.Logger
+}
+
+type logScopeKey struct{}
+
+func withLogScope(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, logScopeKey{}, &logScope{logger: logger})
+}
+
+// logFrom returns the request's logger, or the default logger outside a request.
+func logFrom(ctx context.Context) *slog.Logger {
+	if scope, ok := ctx.Value(logScopeKey{}).(*logScope); ok {
+		scope.mu.Lock()
+		defer scope.mu.Unlock()
+		return scope.logger
+	}
+	return slog.Default()
+}
+
+// addLogAttrs adds attributes to every later line logged for the request.
+func addLogAttrs(ctx context.Context, args ...any) {
+	if scope, ok := ctx.Value(logScopeKey{}).(*logScope); ok {
+		scope.mu.Lock()
+		scope.logger = scope.logger.With(args...)
+		scope.mu.Unlock()
+	}
+}
+
+// validRequestID reports whether a client supplied X-Request-ID is safe to log:
+// short, and limited to letters, digits and . _ - = characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ensureRequestID returns the request's X-Request-ID, replacing a missing or
+// malformed one with a generated ID so later handlers agree on it.
+func ensureRequestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if validRequestID(id) {
+		return id
+	}
+	generated := generateID(8)
+	if id != "" {
+		slog.Debug("Replaced malformed X-Request-ID", "request_id", generated, "length", len(id))
+	}
+	r.Header.Set("X-Request-ID", generated)
+	return generated
+}
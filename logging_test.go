@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useTestLogger captures the default logger's JSON output for the rest of the test.
+func useTestLogger(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	setupLogging(&buf)
+	return &buf
+}
+
+// logLines decodes captured JSON log lines.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+// TestLogRedaction verifies secrets never reach the log output.
+func TestLogRedaction(t *testing.T) {
+	buf := useTestLogger(t)
+
+	secrets := []string{testToken, "s3cr3t-value", "gh-code-123", "state-456", "bearer-credential"}
+	slog.Info("Token "+testToken+" issued",
+		"client_secret", "s3cr3t-value",
+		"location", "https://auth.example.test/oauth/callback?code=gh-code-123&state=state-456",
+		"error", errors.New("header was Bearer bearer-credential"),
+		"status_code", 200,
+	)
+
+	out := buf.String()
+	for _, secret := range secrets {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output contains %q: %s", secret, out)
+		}
+	}
+	entry := logLines(t, buf)[0]
+	if entry["status_code"] != float64(200) {
+		t.Errorf("status_code = %v, want non-secret attributes kept", entry["status_code"])
+	}
+	if got := entry["location"]; got != "https://auth.example.test/oauth/callback?code=[REDACTED]&state=[REDACTED]" {
+		t.Errorf("location = %v, want query credentials redacted", got)
+	}
+}
+
+// TestEnsureRequestID verifies malformed client request IDs are replaced.
+func TestEnsureRequestID(t *testing.T) {
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{header: "abc-123_DEF.4", keep: true},
+		{header: "", keep: false},
+		{header: "fake\n{\"level\":\"ERROR\"}", keep: false},
+		{header: "spaces are not allowed", keep: false},
+		{header: strings.Repeat("a", maxRequestIDLength+1), keep: false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("X-Request-ID", tt.header)
+		got := ensureRequestID(req)
+		if tt.keep != (got == tt.header) {
+			t.Errorf("ensureRequestID(%q) = %q, keep = %v", tt.header, got, tt.keep)
+		}
+		if !validRequestID(got) || req.Header.Get("X-Request-ID") != got {
+			t.Errorf("ensureRequestID(%q) = %q, want a valid ID stored on the request", tt.header, got)
+		}
+	}
+}
+
+// TestRequestScopedLogger verifies handler log lines and the access log carry
+// the request's ID, route, IP and user.
+func TestRequestScopedLogger(t *testing.T) {
+	buf := useTestLogger(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{name}", func(w http.ResponseWriter, r *http.Request) {
+		addLogAttrs(r.Context(), "user", r.PathValue("name"))
+		logFrom(r.Context()).Info("Handled")
+	})
+	handler := requestLogger(mux, mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/alice", http.NoBody)
+	req.RemoteAddr = "192.0.2.7:1234"
+	req.Header.Set("X-Request-ID", "evil\nline")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	requestID := rec.Header().Get("X-Request-ID")
+	if requestID == "evil\nline" || !validRequestID(requestID) {
+		t.Fatalf("X-Request-ID = %q, want a regenerated ID", requestID)
+	}
+	lines := logLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want handler and access lines: %s", len(lines), buf)
+	}
+	for _, entry := range lines {
+		for key, want := range map[string]string{
+			"request_id": requestID,
+			"route":      "GET /users/{name}",
+			"ip":         "192.0.2.7",
+			"user":       "alice",
+		} {
+			if entry[key] != want {
+				t.Errorf("%s line %s = %v, want %q", entry["msg"], key, entry[key], want)
+			}
+		}
+	}
+	if lines[1]["msg"] != "Request completed" || lines[1]["status"] != float64(http.StatusOK) {
+		t.Errorf("access line = %v", lines[1])
+	}
+}
@@ -13,44 +13,34 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/codeGROOVE-dev/gsm"
 	"github.com/codeGROOVE-dev/retry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 // Constants for configuration.
 const (
-	defaultPort        = "8080"
-	defaultAppID       = 1546081
-	defaultClientID    = "Iv23liYmAKkBpvhHAnQQ"
-	defaultRedirectURI = "https://auth.ready-to-review.dev/oauth/callback"
-	baseDomain         = "ready-to-review.dev"
-
-	// Rate limiting.
-	rateLimitRequests = 10
-	rateLimitWindow   = 1 * time.Minute
-
-	// Timeouts.
-	httpTimeout     = 10 * time.Second
-	shutdownTimeout = 30 * time.Second
-	stateExpiry     = 5 * time.Minute
+	defaultPort     = "8080"
+	defaultAppID    = 1546081
+	defaultClientID = "Iv23liYmAKkBpvhHAnQQ"
 
 	// Security.
-	maxRequestSize    = 1 << 20 // 1MB
-	maxHeaderSize     = 1 << 20 // 1MB
-	maxFailedLogins   = 5
-	failedLoginWindow = 15 * time.Minute
+	maxRequestSize = 1 << 20 // 1MB
+	maxHeaderSize  = 1 << 20 // 1MB
 )
 
 //go:embed index.html
@@ -58,15 +48,75 @@ const (
 var staticFiles embed.FS
 
 var (
-	port           = flag.String("port", "", "Port to listen on (overrides $PORT)")
+	configFile  = flag.String("config", "", "YAML or TOML configuration file (overrides $CONFIG_FILE)")
+	printConfig = flag.Bool("print-config", false, "Print the effective configuration and where each value came from, then exit")
+
+	port           = flag.String("port", defaultPort, "Port to listen on")
 	appID          = flag.Int("app-id", defaultAppID, "GitHub App ID")
 	clientID       = flag.String("client-id", defaultClientID, "GitHub OAuth Client ID")
-	clientSecret   = flag.String("client-secret", "", "GitHub OAuth Client Secret")
-	redirectURI    = flag.String("redirect-uri", defaultRedirectURI, "OAuth redirect URI")
+	clientSecret   = flag.String("client-secret", "", "GitHub OAuth Client Secret (fetched from Secret Manager on Cloud Run if empty)")
+	redirectURI    = flag.String("redirect-uri", "", "OAuth redirect URI (default https://<auth host>/oauth/callback)")
 	allowedOrigins = flag.String("allowed-origins", "", "Comma-separated list of allowed origins for CORS")
+	baseDomain     = flag.String("base-domain", defaultBaseDomain, "Domain serving the dashboard; workspaces are its subdomains and OAuth runs on auth.<domain>")
+	workspaceMode  = flag.String("workspace-mode", workspaceModeSubdomain, `Where org workspaces live: "subdomain" (<org>.<domain>) or "path" (/w/<org>/ on a single host)`)
+
+	devMode        = flag.Bool("dev", false, "Serve index.html and assets/ from the working directory with live reload")
+	assetsOverride = flag.String("assets-override", "", "Directory whose index.html and assets/ files take precedence over the embedded ones")
+
+	allowedHosts       = flag.String("allowed-hosts", "", "Comma-separated extra hosts to serve besides the base domain, its subdomains and localhost, e.g. dashboard-123.a.run.app")
+	originalHostSecret = flag.String("original-host-secret", "", "Shared secret the Cloudflare worker signs X-Original-Host with; unsigned values are ignored")
+
+	adminToken      = flag.String("admin-token", "", "Bearer token for the /admin API (disabled if empty)")
+	adminAllowedIPs = flag.String("admin-allowed-ips", defaultAdminAllowedIPs, "Comma-separated IPs or CIDRs allowed to use the /admin API")
+
+	// Rate limiting.
+	rateLimitRequests = flag.Int("rate-limit-requests", 10, "Auth code exchanges allowed per client IP per rate limit window")
+	rateLimitWindow   = flag.Duration("rate-limit-window", 1*time.Minute, "Window for --rate-limit-requests")
+	maxFailedLogins   = flag.Int("max-failed-logins", 5, "Failed auth attempts per client IP logged as a potential attack")
+	failedLoginWindow = flag.Duration("failed-login-window", 15*time.Minute, "Window for --max-failed-logins")
 
-	// Build timestamp for cache busting (set at startup).
-	buildTimestamp string
+	// Timeouts.
+	httpTimeout     = flag.Duration("http-timeout", 10*time.Second, "Read and write timeout for requests, and timeout for GitHub API calls")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "Time allowed for in-flight requests on shutdown")
+	stateExpiry     = flag.Duration("state-expiry", 5*time.Minute, "Lifetime of the OAuth state cookie")
+
+	// Built-in TLS for self-hosting without a TLS-terminating proxy.
+	tlsMode       = flag.String("tls", tlsModeOff, "Serve HTTPS on --port: off, files (--tls-cert and --tls-key) or acme")
+	tlsCertFile   = flag.String("tls-cert", "", "PEM certificate chain for --tls=files, reloaded when it changes")
+	tlsKeyFile    = flag.String("tls-key", "", "PEM private key for --tls=files, reloaded when it changes")
+	httpPort      = flag.String("http-port", "80", "Port for the HTTP listener that redirects to HTTPS and answers ACME challenges when TLS is on (disabled if empty)")
+	acmeEmail     = flag.String("acme-email", "", "Contact email for the ACME account")
+	acmeCacheDir  = flag.String("acme-cache-dir", "acme-cache", "Directory where ACME account keys and certificates are stored")
+	acmeDirectory = flag.String("acme-directory", autocert.DefaultACMEDirectory, "ACME directory URL")
+	acmeDNSHook   = flag.String("acme-dns-hook", "", "Program run as '<hook> present|cleanup <fqdn> <value>' to publish DNS-01 TXT records; enables a wildcard certificate for the base domain")
+
+	// Outbound connections.
+	egressProxyURL      = flag.String("egress-proxy", "", "HTTP or HTTPS proxy URL for all outbound calls (default: HTTPS_PROXY and friends)")
+	egressProxyUser     = flag.String("egress-proxy-user", "", "Username for --egress-proxy")
+	egressProxyPassword = flag.String("egress-proxy-password", "", "Password for --egress-proxy")
+	egressCAFile        = flag.String("egress-ca-file", "", "PEM bundle of extra CAs trusted for outbound TLS, including to an HTTPS proxy")
+	egressAllowedHosts  = flag.String("egress-allowed-hosts", "", "Comma-separated hosts outbound calls may reach, e.g. github.com,api.github.com,*.googleapis.com (any host if empty)")
+
+	// Concurrency limits; requests beyond them are shed with a 503.
+	maxAuthRequests   = flag.Int("max-auth-requests", 64, "OAuth requests served at once")
+	maxStaticRequests = flag.Int("max-static-requests", 512, "Static file and frontend config requests served at once")
+
+	// Security state kept across restarts.
+	stateSnapshotPath = flag.String("state-snapshot", "", "File the pending auth codes, rate limits and failed attempts are saved to on shutdown and restored from at startup (disabled if empty)")
+	stateSnapshotKey  = flag.String("state-snapshot-key", "", "Base64 AES-256 key that encrypts --state-snapshot")
+
+	// Maintenance windows close the OAuth endpoints; see also SIGUSR1/SIGUSR2 on unix and /admin/maintenance.
+	maintenanceMode    = flag.Bool("maintenance", false, "Start in maintenance mode, with sign-in closed until turned off")
+	maintenanceStart   = flag.String("maintenance-start", "", "RFC 3339 time a scheduled maintenance window starts (now if empty)")
+	maintenanceEnd     = flag.String("maintenance-end", "", "RFC 3339 time the maintenance window ends (until turned off if empty)")
+	maintenanceMessage = flag.String("maintenance-message", "", "Message shown during maintenance")
+
+	// Observability.
+	metricsAddr = flag.String("metrics-addr", "", "Address such as 127.0.0.1:9090 for a separate Prometheus /metrics listener (disabled if empty)")
+
+	// Embedded files, fingerprinted and precompressed once at startup.
+	// Swapped atomically when --dev reloads files from disk.
+	staticAssets atomic.Pointer[assetStore]
 
 	// Security: Track failed login attempts.
 	failedAttempts = make(map[string][]time.Time)
@@ -77,6 +127,13 @@ var (
 	authCodes      = make(map[string]authCodeData)
 	authCodesMutex sync.Mutex
 
+	// GitHub endpoints. Overridden in tests to point at a fake GitHub.
+	githubURL    = "https://github.com"
+	githubAPIURL = "https://api.github.com"
+
+	// Seals tokens held in authCodes so they are never kept in plaintext.
+	authCodeSealer *tokenSealer
+
 	// Rate limiter for auth code exchange endpoint (prevent brute force attacks).
 	exchangeRateLimiter *rateLimiter
 
@@ -85,12 +142,13 @@ var (
 )
 
 // authCodeData stores a one-time use auth code with expiration.
+// The token is sealed with authCodeSealer and only opened on exchange.
 type authCodeData struct {
-	expiry   time.Time
-	token    string
-	username string
-	returnTo string
-	used     bool
+	expiry      time.Time
+	username    string
+	returnTo    string
+	sealedToken []byte
+	used        bool
 }
 
 // rateLimiter implements a simple in-memory rate limiter.
@@ -120,7 +178,8 @@ func (rl *rateLimiter) limitHandler(next http.HandlerFunc) http.HandlerFunc {
 		}
 
 		if len(validRequests) >= rl.limit {
-			log.Printf("[SECURITY] Rate limit exceeded: ip=%s requests=%d limit=%d window=%v", ip, len(validRequests), rl.limit, rl.window)
+			logFrom(r.Context()).Warn("Rate limit exceeded", securityEvent, "requests", len(validRequests), "limit", rl.limit, "window", rl.window.String())
+			rateLimitRejections.Inc()
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
@@ -198,10 +257,7 @@ func clientIP(r *http.Request) string {
 func securityHeaders(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Add request ID for tracking
-		requestID := r.Header.Get("X-Request-ID")
-		if requestID == "" {
-			requestID = generateID(8)
-		}
+		requestID := ensureRequestID(r)
 		w.Header().Set("X-Request-ID", requestID)
 		// Prevent clickjacking
 		w.Header().Set("X-Frame-Options", "DENY")
@@ -219,26 +275,35 @@ func securityHeaders(next http.Handler) http.Handler {
 		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
 
 		// Content Security Policy with Trusted Types for DOM XSS protection
+		// Workspace subdomains load assets from the base domain
+		origin := "https://" + *baseDomain
 		csp := []string{
-			"default-src 'self' https://ready-to-review.dev",
-			"script-src 'self' https://ready-to-review.dev",
-			"style-src 'self' https://ready-to-review.dev",
-			"img-src 'self' https://ready-to-review.dev https://avatars.githubusercontent.com data:",
+			"default-src 'self' " + origin,
+			"script-src 'self' " + origin,
+			"style-src 'self' " + origin,
+			"img-src 'self' " + origin + " https://avatars.githubusercontent.com data:",
 			"connect-src 'self' https://api.github.com https://turn.github.codegroove.app",
-			"font-src 'self' https://ready-to-review.dev",
+			"font-src 'self' " + origin,
+			"worker-src 'self'",   // Service worker for the offline shell
+			"manifest-src 'self'", // Web app manifest
 			"object-src 'none'",
 			"frame-src 'none'",
 			"base-uri 'self'",
 			"form-action 'self'",
 			"frame-ancestors 'none'",
-			"upgrade-insecure-requests",          // Force all resources to HTTPS
 			"require-trusted-types-for 'script'", // Block DOM XSS via innerHTML
 			"trusted-types default",              // Allow only default policy
 		}
+
+		// Developer mode on localhost runs over plain HTTP, so don't force HTTPS
+		relaxed := *devMode && isLocalhost(r.Host)
+		if !relaxed {
+			csp = append(csp, "upgrade-insecure-requests") // Force all resources to HTTPS
+		}
 		w.Header().Set("Content-Security-Policy", strings.Join(csp, "; "))
 
 		// HSTS with preload (only for HTTPS)
-		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		if !relaxed && (r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https") {
 			// 2 years (recommended for preload), includeSubDomains, and preload directive
 			w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
 		}
@@ -267,29 +332,32 @@ type githubUser struct {
 func loadClientSecret(ctx context.Context) string {
 	// Check environment variable first
 	if value := os.Getenv("GITHUB_CLIENT_SECRET"); value != "" {
-		log.Print("Using GITHUB_CLIENT_SECRET from environment variable")
+		slog.Info("Using GITHUB_CLIENT_SECRET from environment variable")
 		return value
 	}
 
 	// Check if running in Cloud Run
 	isCloudRun := os.Getenv("K_SERVICE") != "" || os.Getenv("CLOUD_RUN_TIMEOUT_SECONDS") != ""
 	if !isCloudRun {
-		log.Print("Not running in Cloud Run, skipping Secret Manager")
+		slog.Info("Not running in Cloud Run, skipping Secret Manager")
 		return ""
 	}
 
 	// Fetch from Secret Manager (auto-detects project ID from metadata server)
-	log.Print("Fetching GITHUB_CLIENT_SECRET from Google Secret Manager")
-	secretValue, err := gsm.Fetch(ctx, "GITHUB_CLIENT_SECRET")
+	slog.Info("Fetching GITHUB_CLIENT_SECRET from Google Secret Manager")
+	ctx, span := tracer().Start(ctx, "secretmanager.fetch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("secret.name", "GITHUB_CLIENT_SECRET")))
+	secretValue, err := fetchSecret(ctx, "GITHUB_CLIENT_SECRET")
+	endSpan(span, err)
 	if err != nil {
-		log.Printf("Failed to fetch secret from Secret Manager: %v", err)
+		slog.Error("Failed to fetch secret from Secret Manager", "error", err)
 		return ""
 	}
 
 	if secretValue == "" {
-		log.Print("WARNING: Secret Manager returned empty value for GITHUB_CLIENT_SECRET")
+		slog.Warn("Secret Manager returned empty value for GITHUB_CLIENT_SECRET")
 	} else {
-		log.Print("Successfully fetched GITHUB_CLIENT_SECRET from Google Secret Manager")
+		slog.Info("Fetched GITHUB_CLIENT_SECRET from Google Secret Manager")
 	}
 
 	return secretValue
@@ -297,115 +365,180 @@ func loadClientSecret(ctx context.Context) string {
 
 func main() {
 	flag.Parse()
+	setupLogging(os.Stderr)
 
-	// Set build timestamp for cache busting
-	buildTimestamp = strconv.FormatInt(time.Now().Unix(), 10)
-
-	// Determine port with flag taking precedence over environment
-	serverPort := *port
-	if serverPort == "" {
-		serverPort = os.Getenv("PORT")
+	// Layer configuration: flag > env > config file > default
+	sources, err := loadConfig()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
 	}
-	if serverPort == "" {
-		serverPort = defaultPort
+
+	// Proxy, CA bundle and allowlist apply to every outbound call from here on
+	if err := setupEgress(); err != nil {
+		fatal("Invalid egress configuration", "error", err)
 	}
 
-	// Allow environment variables to override empty flag values
-	if *appID == defaultAppID {
-		if envAppID := os.Getenv("GITHUB_APP_ID"); envAppID != "" {
-			if id, err := strconv.Atoi(envAppID); err == nil {
-				*appID = id
-			}
-		}
+	// Tracing is configured by the standard OTEL_* environment variables
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		fatal("Failed to set up tracing", "error", err)
 	}
 
-	if *clientID == defaultClientID || *clientID == "" {
-		if envClientID := os.Getenv("GITHUB_CLIENT_ID"); envClientID != "" {
-			*clientID = envClientID
-		}
+	// The callback lives on the auth host of whichever domain we serve
+	if *redirectURI == "" {
+		*redirectURI = "https://" + authHost() + "/oauth/callback"
+		sources["redirect-uri"] = configSource{kind: sourceDerived, detail: "from base-domain and workspace-mode"}
 	}
 
-	// Load client secret from environment or Secret Manager
+	// Fall back to Secret Manager for the client secret
 	if *clientSecret == "" {
-		ctx := context.Background()
-		*clientSecret = loadClientSecret(ctx)
+		*clientSecret = loadClientSecret(context.Background())
+		if *clientSecret != "" {
+			sources["client-secret"] = configSource{kind: sourceSecrets}
+		}
 	}
 
-	if *redirectURI == defaultRedirectURI || *redirectURI == "" {
-		if envRedirectURI := os.Getenv("OAUTH_REDIRECT_URI"); envRedirectURI != "" {
-			*redirectURI = envRedirectURI
+	configErr := validateConfig(sources)
+	if *printConfig {
+		if err := writeConfig(os.Stdout, flag.CommandLine, settings, sources); err != nil {
+			fatal("Failed to print configuration", "error", err)
+		}
+		if configErr != nil {
+			fmt.Fprintf(os.Stderr, "\nInvalid configuration:\n%v\n", configErr)
+			os.Exit(1)
 		}
+		return
+	}
+	if configErr != nil {
+		fatal("Invalid configuration", "error", configErr)
 	}
 
-	if *allowedOrigins == "" {
-		if envAllowedOrigins := os.Getenv("ALLOWED_ORIGINS"); envAllowedOrigins != "" {
-			*allowedOrigins = envAllowedOrigins
+	// Layer self-hosted overrides (logo, CSS, demo data...) over the embedded files
+	var staticFS fs.FS = staticFiles
+	var overrideFS fs.FS
+	if *assetsOverride != "" {
+		var err error
+		overrideFS, err = openOverrideFS(*assetsOverride)
+		if err != nil {
+			fatal("Failed to open assets override directory", "error", err)
 		}
+		staticFS = newOverlayFS(overrideFS, staticFiles)
+		slog.Info("Serving asset overrides", "dir", *assetsOverride)
+	}
+
+	// Prepare static files once: fingerprint assets by content hash and precompress everything
+	assets, err := newAssetStore(staticFS, true)
+	if err != nil {
+		fatal("Failed to prepare static assets", "error", err)
+	}
+	staticAssets.Store(assets)
+
+	// Initialize the sealer for tokens waiting in the auth code store
+	authCodeKey, err := loadAuthCodeKey()
+	if err != nil {
+		fatal("Failed to load auth code key", "error", err)
+	}
+	authCodeSealer, err = newTokenSealer(authCodeKey)
+	wipe(authCodeKey)
+	if err != nil {
+		fatal("Failed to initialize auth code sealer", "error", err)
 	}
 
 	// Initialize rate limiter for auth code exchange (strict: 10 attempts per minute per IP)
 	exchangeRateLimiter = &rateLimiter{
 		requests: make(map[string][]time.Time),
-		limit:    rateLimitRequests,
-		window:   rateLimitWindow,
+		limit:    *rateLimitRequests,
+		window:   *rateLimitWindow,
+	}
+
+	// Restore the state saved by the previous process's graceful shutdown
+	var snapshotSealer *tokenSealer
+	if *stateSnapshotPath != "" {
+		key, err := loadSnapshotKey(*stateSnapshotKey)
+		if err != nil {
+			fatal("Failed to load state snapshot key", "error", err)
+		}
+		snapshotSealer, err = newTokenSealer(key)
+		wipe(key)
+		if err != nil {
+			fatal("Failed to initialize state snapshot sealer", "error", err)
+		}
+		if err := restoreSnapshot(*stateSnapshotPath, snapshotSealer, time.Now()); err != nil {
+			slog.Error("Failed to restore security state snapshot, starting empty", "path", *stateSnapshotPath, "error", err)
+		}
 	}
 
 	// Initialize CSRF protection using Go 1.25's CrossOriginProtection
 	// Uses Fetch Metadata (Sec-Fetch-Site header) for reliable cross-origin detection
-	csrfProtection = http.NewCrossOriginProtection()
-	// Trust requests from our own domain and all subdomains
-	if err := csrfProtection.AddTrustedOrigin("https://" + baseDomain); err != nil {
-		log.Fatalf("CRITICAL: Failed to configure CSRF protection for base domain: %v", err)
+	csrfProtection, err = newCSRFProtection()
+	if err != nil {
+		fatal("Failed to configure CSRF protection", "error", err)
+	}
+
+	// Admin API for inspecting runtime security state (disabled without an admin token)
+	admin, err := newAdminServer(*adminToken, *adminAllowedIPs, adminConfig{
+		Port:              *port,
+		AppID:             *appID,
+		ClientID:          *clientID,
+		ClientSecret:      redact(*clientSecret),
+		RedirectURI:       *redirectURI,
+		AllowedOrigins:    *allowedOrigins,
+		BaseDomain:        *baseDomain,
+		WorkspaceMode:     *workspaceMode,
+		RateLimitRequests: *rateLimitRequests,
+		RateLimitWindow:   rateLimitWindow.String(),
+		MaxFailedLogins:   *maxFailedLogins,
+		FailedLoginWindow: failedLoginWindow.String(),
+	})
+	if err != nil {
+		fatal("Failed to configure admin API", "error", err)
+	}
+	if admin != nil {
+		slog.Info("Admin API enabled", "allowed_ips", *adminAllowedIPs)
 	}
-	if err := csrfProtection.AddTrustedOrigin("https://*." + baseDomain); err != nil {
-		log.Fatalf("CRITICAL: Failed to configure CSRF protection for subdomains: %v", err)
+
+	// Maintenance windows from the config; on unix SIGUSR1 and SIGUSR2 turn maintenance on and off
+	window, err := parseMaintenanceConfig()
+	if err != nil {
+		fatal("Failed to configure maintenance window", "error", err)
 	}
-	// Allow localhost for development (covers all ports)
-	if err := csrfProtection.AddTrustedOrigin("http://localhost"); err != nil {
-		log.Fatalf("CRITICAL: Failed to configure CSRF protection for localhost: %v", err)
+	if window != nil {
+		setMaintenance(window, "config")
 	}
+	maintenanceCtx, stopMaintenance := context.WithCancel(context.Background())
+	defer stopMaintenance()
+	notifyMaintenanceSignals(maintenanceCtx)
 
 	// Set up routes
-	mux := http.NewServeMux()
-
-	// OAuth endpoints
-	// Register API endpoints before catch-all to ensure they match first
-	// Auth code exchange has rate limiting + CSRF protection (Go 1.25 CrossOriginProtection)
-	mux.Handle("/oauth/exchange", csrfProtection.Handler(exchangeRateLimiter.limitHandler(handleExchangeAuthCode)))
-	mux.HandleFunc("/oauth/login", handleOAuthLogin)
-	mux.HandleFunc("/oauth/callback", handleOAuthCallback)
-	mux.HandleFunc("/oauth/user", handleGetUser)
-
-	// Health check endpoint
-	mux.HandleFunc("/health", handleHealthCheck)
-
-	// Serve everything else as SPA (including assets)
-	// This MUST be registered last as it's a catch-all
-	mux.HandleFunc("/", serveStaticFiles)
+	mux := newMux(admin)
 
 	// Wrap with security middleware
-	handler := requestLogger(requestSizeLimiter(securityHeaders(mux)))
+	handler := requestLogger(mux, instrumentRoutes(mux, traceRequests(mux, requestSizeLimiter(securityHeaders(checkHost(mux))))))
 
 	// Start server with graceful shutdown
-	addr := ":" + serverPort
+	addr := ":" + *port
 	srv := &http.Server{
 		Addr:           addr,
 		Handler:        handler,
-		ReadTimeout:    httpTimeout,
-		WriteTimeout:   httpTimeout,
-		IdleTimeout:    httpTimeout * 12, // 2 minutes
+		ReadTimeout:    *httpTimeout,
+		WriteTimeout:   *httpTimeout,
+		IdleTimeout:    *httpTimeout * 12, // 2 minutes by default
 		MaxHeaderBytes: maxHeaderSize,
 	}
 
-	log.Printf("Starting server on %s", addr)
-	log.Printf("GitHub App ID: %d", *appID)
-	log.Printf("OAuth Client ID: %s", *clientID)
-	log.Printf("OAuth Redirect URI: %s", *redirectURI)
+	// Developer mode: serve files from disk and reload browsers when they change
+	devCtx, stopDev := context.WithCancel(context.Background())
+	defer stopDev()
+	if *devMode {
+		if err := startDevMode(devCtx, mux, srv, overrideFS); err != nil {
+			fatal("Failed to start developer mode", "error", err)
+		}
+	}
+
+	slog.Info("Starting server", "addr", addr, "tls", *tlsMode, "app_id", *appID, "client_id", *clientID,
+		"redirect_uri", *redirectURI, "client_secret_set", *clientSecret != "")
 	if *clientSecret == "" {
-		log.Print("WARNING: OAuth Client Secret not set. OAuth login will not work.")
-		log.Print("Set GITHUB_CLIENT_SECRET environment variable or use --client-secret flag")
-	} else {
-		log.Print("OAuth Client Secret: configured")
+		slog.Warn("OAuth client secret not set, OAuth login will not work; set GITHUB_CLIENT_SECRET or --client-secret")
 	}
 
 	// Start auth code cleanup goroutine
@@ -425,46 +558,168 @@ func main() {
 		}
 	}()
 
+	// Built-in TLS serves HTTPS (with HTTP/2) on --port, plus an HTTP listener
+	// that redirects to it and answers ACME challenges
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+	certs, err := newTLSSetup(tlsCtx)
+	if err != nil {
+		fatal("Failed to configure TLS", "error", err)
+	}
+	var redirectSrv *http.Server
+	if certs != nil {
+		srv.TLSConfig = certs.config
+		srv.Protocols = httpProtocols()
+		go certs.start(tlsCtx)
+		if *httpPort != "" {
+			redirectSrv = &http.Server{
+				Addr:              ":" + *httpPort,
+				Handler:           certs.redirect,
+				ReadHeaderTimeout: *httpTimeout,
+				WriteTimeout:      *httpTimeout,
+			}
+			go func() {
+				slog.Info("Redirecting HTTP to HTTPS", "addr", redirectSrv.Addr)
+				if err := redirectSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					fatal("HTTP redirect server failed to start", "error", err)
+				}
+			}()
+		}
+	}
+
 	// Start server in goroutine
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Server failed to start: %v", err)
+		serve := srv.ListenAndServe
+		if certs != nil {
+			serve = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Server failed to start", "error", err)
 		}
 	}()
 
+	// Metrics get their own listener so they are never exposed on the public port
+	var metricsSrv *http.Server
+	if *metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metricsHandler())
+		metricsSrv = &http.Server{
+			Addr:              *metricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: *httpTimeout,
+			WriteTimeout:      *httpTimeout,
+		}
+		go func() {
+			slog.Info("Serving metrics", "addr", *metricsAddr, "path", "/metrics")
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("Metrics server failed to start", "error", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal to gracefully shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	slog.Info("Shutting down server")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Server forced to shutdown: %v", err)
+		slog.Error("Server forced to shutdown", "error", err)
+	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			slog.Error("HTTP redirect server forced to shutdown", "error", err)
+		}
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			slog.Error("Metrics server forced to shutdown", "error", err)
+		}
 	}
 
-	log.Println("Server exited")
+	// Requests have finished, so nothing changes the state while it is saved
+	if snapshotSealer != nil {
+		if err := saveSnapshot(*stateSnapshotPath, snapshotSealer, time.Now()); err != nil {
+			slog.Error("Failed to save security state snapshot", "path", *stateSnapshotPath, "error", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
+	slog.Info("Server exited")
+}
+
+// newMux registers the application routes. The admin API is only mounted when
+// admin is non-nil.
+func newMux(admin *adminServer) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// API routes called from the frontend with fetch get the --allowed-origins
+	// CORS policy; wrap any new one in api
+	cors, _ := parseAllowedOrigins(*allowedOrigins) //nolint:errcheck // checked by validateConfig
+	api := cors.handler
+
+	// Separate concurrency pools keep slow OAuth requests from starving static
+	// files; health checks and the admin API are never shed
+	auth := newConcurrencyPool(poolAuth, *maxAuthRequests).limit
+	static := newConcurrencyPool(poolStatic, *maxStaticRequests).limit
+
+	// OAuth endpoints
+	// Register API endpoints before catch-all to ensure they match first
+	// Auth code exchange has rate limiting + CSRF protection (Go 1.25 CrossOriginProtection)
+	// All of them are closed during maintenance windows: pages the browser
+	// navigates to get an HTML 503, fetch calls plain text
+	mux.Handle("/oauth/exchange", api(duringMaintenance(false, auth(cors.protect(csrfProtection, exchangeRateLimiter.limitHandler(handleExchangeAuthCode))))))
+	mux.Handle("/oauth/login", duringMaintenance(true, auth(http.HandlerFunc(handleOAuthLogin))))
+	// Routes that call GitHub get a deadline shared by all their attempts
+	mux.Handle("/oauth/callback", duringMaintenance(true, auth(withDeadline(routeDeadline(), handleOAuthCallback))))
+	mux.Handle("/oauth/user", api(duringMaintenance(false, auth(withDeadline(routeDeadline(), handleGetUser)))))
+	mux.Handle(maintenanceStatusPath, api(static(http.HandlerFunc(handleMaintenanceStatus))))
+
+	// Health check endpoint
+	mux.HandleFunc("/health", handleHealthCheck)
+	mux.HandleFunc("GET "+livenessPath, handleLiveness)
+	mux.HandleFunc("GET "+readinessPath, handleReadiness)
+
+	// Deployment settings for the frontend
+	mux.Handle(clientConfigPath, static(http.HandlerFunc(handleClientConfig)))
+
+	if admin != nil {
+		mux.Handle("/admin/", csrfProtection.Handler(admin.handler()))
+	}
+
+	// Offline shell: service worker, its precache list and the web app manifest
+	mux.Handle(serviceWorkerPath, static(http.HandlerFunc(handleServiceWorker)))
+	mux.Handle(precacheListPath, static(http.HandlerFunc(handlePrecacheList)))
+	mux.Handle(webAppManifestPath, static(http.HandlerFunc(handleWebAppManifest)))
+
+	// Serve everything else as SPA (including assets)
+	// This MUST be registered last as it's a catch-all
+	mux.Handle("/", static(http.HandlerFunc(serveStaticFiles)))
+	return mux
 }
 
 func serveStaticFiles(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET, HEAD, and OPTIONS methods
 	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
-		log.Printf("[serveStaticFiles] Rejecting %s request to %s (405)", r.Method, r.URL.Path)
+		logFrom(r.Context()).Debug("Rejecting static file request with unsupported method")
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// CORS: Allow subdomains to load assets from naked domain
-	// Check Origin header and allow all subdomains of ready-to-review.dev
+	// Check Origin header and allow all subdomains of the base domain
 	origin := r.Header.Get("Origin")
 	if origin != "" {
 		// Parse origin to validate it's one of our subdomains
 		if u, err := url.Parse(origin); err == nil {
-			host := u.Hostname()
 			// Allow naked domain and all subdomains
-			if host == baseDomain || strings.HasSuffix(host, "."+baseDomain) {
+			if isOurHost(u.Hostname()) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
 				w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type")
@@ -495,68 +750,64 @@ func serveStaticFiles(w http.ResponseWriter, r *http.Request) {
 		path = strings.TrimPrefix(path, "/")
 	}
 
-	// Try to read the file from embedded FS
-	data, err := staticFiles.ReadFile(path)
-	if err != nil {
-		// If file not found and not an asset, serve index.html for SPA routing
-		if !strings.HasPrefix(path, "assets/") && !strings.HasSuffix(path, ".ico") {
-			data, err = staticFiles.ReadFile("index.html")
-			if err != nil {
-				log.Printf("Failed to serve fallback index.html: %v", err)
-				http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+	// Path-based workspaces: every route under /w/{org}/ is handled by the SPA
+	assets := staticAssets.Load()
+	if usePathWorkspaces() {
+		if org, rest, ok := cutWorkspacePath(r.URL.Path); ok {
+			if !isValidGitHubHandle(org) {
+				http.NotFound(w, r)
 				return
 			}
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.Header().Set("Cache-Control", "no-cache")
-			if _, err := w.Write(data); err != nil {
-				log.Printf("Failed to write response: %v", err)
+			if rest == "" {
+				target := workspacePathPrefix + org + "/"
+				if r.URL.RawQuery != "" {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, http.StatusMovedPermanently)
+				return
 			}
+			serveIndex(w, r, assets)
+			return
+		}
+	}
+
+	// Look up the precompressed file from the embedded FS
+	asset, immutable, ok := assets.lookup(path)
+	if !ok {
+		// If file not found and not an asset, serve index.html for SPA routing
+		if !strings.HasPrefix(path, "assets/") && !strings.HasSuffix(path, ".ico") {
+			serveIndex(w, r, assets)
 			return
 		}
 		http.NotFound(w, r)
 		return
 	}
 
-	// Set content type and cache headers based on file extension
-	switch {
-	case strings.HasSuffix(path, ".html"):
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		// Never cache HTML files - they contain BUILD_TIMESTAMP references to versioned assets
-		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		w.Header().Set("Pragma", "no-cache")
-		w.Header().Set("Expires", "0")
-		// Replace BUILD_TIMESTAMP placeholder with actual timestamp for cache busting
-		data = []byte(strings.ReplaceAll(string(data), "BUILD_TIMESTAMP", buildTimestamp))
-	case strings.HasSuffix(path, ".css"):
-		w.Header().Set("Content-Type", "text/css; charset=utf-8")
-		// Cache CSS for 1 year since URL includes version query param
-		if r.URL.Query().Get("v") != "" {
-			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-		}
-	case strings.HasSuffix(path, ".js"):
-		w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
-		// Cache JS for 1 year since URL includes version query param
-		if r.URL.Query().Get("v") != "" {
-			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-		}
-	case strings.HasSuffix(path, ".json"):
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	case strings.HasSuffix(path, ".png"):
-		w.Header().Set("Content-Type", "image/png")
-	case strings.HasSuffix(path, ".jpg"), strings.HasSuffix(path, ".jpeg"):
-		w.Header().Set("Content-Type", "image/jpeg")
-	case strings.HasSuffix(path, ".svg"):
-		w.Header().Set("Content-Type", "image/svg+xml")
-	case strings.HasSuffix(path, ".ico"):
-		w.Header().Set("Content-Type", "image/x-icon")
-	default:
-		// No specific content type
+	// Fingerprinted URLs change whenever content does, so they can be cached for 1 year.
+	// Everything else (HTML, unhashed or stale asset URLs) must be revalidated.
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
 	}
 
-	// Write the file content
-	if _, err := w.Write(data); err != nil {
-		log.Printf("Failed to write file content: %v", err)
+	assets.serve(w, r, path, asset)
+}
+
+// serveIndex serves index.html for a route the frontend handles.
+func serveIndex(w http.ResponseWriter, r *http.Request, assets *assetStore) {
+	index, _, ok := assets.lookup("index.html")
+	if !ok {
+		logFrom(r.Context()).Error("Failed to serve fallback index.html: not embedded")
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return
 	}
+	// Routes the frontend understands get link preview tags for chat unfurls
+	if serveSharePage(w, r, assets, index) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	assets.serve(w, r, "index.html", index)
 }
 
 // validateReturnToURL validates that a return_to URL is safe to redirect to.
@@ -579,26 +830,35 @@ func validateReturnToURL(returnTo string) string {
 	case "http", "https":
 		// Valid scheme, continue validation
 	default:
-		log.Printf("[SECURITY] Invalid return_to scheme: %s", urlScheme)
+		slog.Warn("Invalid return_to scheme", securityEvent, "scheme", urlScheme)
 		return ""
 	}
 
+	// Path-based workspaces live on the base domain itself
+	if usePathWorkspaces() {
+		if host != *baseDomain {
+			slog.Warn("Invalid return_to domain", securityEvent, "host", host)
+			return ""
+		}
+		if org, _, ok := cutWorkspacePath(parsedURL.Path); ok && !isValidGitHubHandle(org) {
+			slog.Warn("Invalid GitHub handle in return_to workspace path", securityEvent, "org", org)
+			return ""
+		}
+		return returnTo
+	}
+
 	// Validate domain is ours
-	if host != baseDomain && !strings.HasSuffix(host, "."+baseDomain) {
-		log.Printf("[SECURITY] Invalid return_to domain: %s", host)
+	if !isOurHost(host) {
+		slog.Warn("Invalid return_to domain", securityEvent, "host", host)
 		return ""
 	}
 
 	// Validate subdomain format if not base domain
-	if host != baseDomain {
-		parts := strings.Split(host, ".")
-		if len(parts) >= 3 {
-			subdomain := parts[0]
-			// Validate subdomain is a valid GitHub handle (prevents punycode, homograph attacks, etc.)
-			if !isValidGitHubHandle(subdomain) {
-				log.Printf("[SECURITY] Invalid GitHub handle in return_to subdomain: %s", subdomain)
-				return ""
-			}
+	if subdomain, ok := strings.CutSuffix(host, "."+*baseDomain); ok {
+		// Validate subdomain is a single valid GitHub handle (prevents punycode, homograph attacks, etc.)
+		if !isValidGitHubHandle(subdomain) {
+			slog.Warn("Invalid GitHub handle in return_to subdomain", securityEvent, "subdomain", subdomain)
+			return ""
 		}
 	}
 
@@ -607,13 +867,14 @@ func validateReturnToURL(returnTo string) string {
 
 func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
 	if *clientID == "" {
-		log.Print("OAuth login attempted but client ID not configured. Set GITHUB_CLIENT_ID environment variable or use --client-id flag")
+		logFrom(r.Context()).Error("OAuth login attempted but client ID not configured; set GITHUB_CLIENT_ID or --client-id")
 		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
 		return
 	}
 
-	// Get current host to determine return destination
-	currentHost := r.Header.Get("X-Original-Host")
+	// Get current host to determine return destination; checkHost only lets
+	// X-Original-Host through when the worker signed it
+	currentHost := r.Header.Get(originalHostHeader)
 	if currentHost == "" {
 		currentHost = r.Host
 	}
@@ -624,11 +885,12 @@ func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
 		scheme = "https"
 	}
 
-	// If not on auth subdomain, redirect there with return_to parameter
-	if !strings.HasPrefix(currentHost, "auth.") {
+	// If not on auth subdomain, redirect there with return_to parameter.
+	// Path-based workspaces run OAuth on the same host, so the frontend passes return_to itself.
+	if !usePathWorkspaces() && !strings.HasPrefix(currentHost, "auth.") {
 		returnTo := fmt.Sprintf("%s://%s/", scheme, currentHost)
-		authURL := fmt.Sprintf("%s://auth.%s/oauth/login?return_to=%s", scheme, baseDomain, url.QueryEscape(returnTo))
-		log.Printf("[OAuth] Redirecting to auth subdomain: %s", authURL)
+		authURL := fmt.Sprintf("%s://%s/oauth/login?return_to=%s", scheme, authHost(), url.QueryEscape(returnTo))
+		logFrom(r.Context()).Info("Redirecting to auth subdomain", "location", authURL)
 		http.Redirect(w, r, authURL, http.StatusFound)
 		return
 	}
@@ -661,28 +923,29 @@ func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		Secure:   isSecure,
 		SameSite: http.SameSiteLaxMode, // Lax required for OAuth redirect from GitHub
-		Expires:  time.Now().Add(stateExpiry),
+		Expires:  time.Now().Add(*stateExpiry),
 	}
 	http.SetCookie(w, stateCookie)
 
-	// Build authorization URL (always use auth.ready-to-review.dev callback)
+	// Build authorization URL (always use the auth host callback)
 	authURL := fmt.Sprintf(
-		"https://github.com/login/oauth/authorize?client_id=%s&redirect_uri=%s&scope=%s&state=%s",
+		"%s/login/oauth/authorize?client_id=%s&redirect_uri=%s&scope=%s&state=%s",
+		githubURL,
 		url.QueryEscape(*clientID),
 		url.QueryEscape(*redirectURI),
 		url.QueryEscape("repo read:org"),
 		url.QueryEscape(stateData),
 	)
 
-	log.Printf("[OAuth] Starting OAuth with return_to=%s", returnTo)
+	logFrom(r.Context()).Info("Starting OAuth", "return_to", returnTo)
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
 func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	if *clientID == "" || *clientSecret == "" {
-		log.Printf("OAuth callback attempted but not configured: client_id=%q client_secret_set=%v",
-			*clientID, *clientSecret != "")
-		log.Print("Set GITHUB_CLIENT_SECRET environment variable or --client-secret flag")
+		logFrom(r.Context()).Error("OAuth callback attempted but not configured; set GITHUB_CLIENT_SECRET or --client-secret",
+			"client_id", *clientID, "client_secret_set", *clientSecret != "")
+		oauthCallbacks.WithLabelValues(oauthNotConfigured).Inc()
 		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
 		return
 	}
@@ -690,7 +953,8 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	// Check for OAuth errors from GitHub
 	if errCode := r.URL.Query().Get("error"); errCode != "" {
 		errDesc := r.URL.Query().Get("error_description")
-		log.Printf("OAuth error: %s - %s", errCode, errDesc)
+		logFrom(r.Context()).Info("OAuth denied by GitHub", "error_code", errCode, "description", errDesc)
+		oauthCallbacks.WithLabelValues(oauthDenied).Inc()
 
 		// Return user-friendly error page
 		escapedMsg := strings.NewReplacer(
@@ -715,7 +979,7 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 `, escapedMsg)
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if _, err := w.Write([]byte(html)); err != nil {
-			log.Printf("Failed to write error response: %v", err)
+			logFrom(r.Context()).Error("Failed to write error response", "error", err)
 		}
 		return
 	}
@@ -726,7 +990,8 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 
 	if installationID != "" && setupAction != "" {
 		// This is a GitHub App installation callback
-		log.Printf("GitHub App installation callback: installation_id=%s, setup_action=%s", installationID, setupAction)
+		logFrom(r.Context()).Info("GitHub App installation callback", "installation_id", installationID, "setup_action", setupAction)
+		oauthCallbacks.WithLabelValues(oauthAppInstalled).Inc()
 
 		// Return a success page for app installations
 		escapedAction := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "'", "&#39;").Replace(setupAction)
@@ -754,7 +1019,7 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 `, escapedAction, escapedID)
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		if _, err := w.Write([]byte(html)); err != nil {
-			log.Printf("Failed to write GitHub App installation response: %v", err)
+			logFrom(r.Context()).Error("Failed to write GitHub App installation response", "error", err)
 		}
 		return
 	}
@@ -763,7 +1028,8 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	state := r.URL.Query().Get("state")
 	if state == "" {
 		trackFailedAttempt(clientIP(r))
-		log.Printf("[OAuth] Missing state parameter from %s", clientIP(r))
+		logFrom(r.Context()).Warn("Missing OAuth state parameter", securityEvent)
+		oauthCallbacks.WithLabelValues(oauthMissingState).Inc()
 		clearStateCookie(w)
 		http.Error(w, "Missing state parameter", http.StatusBadRequest)
 		return
@@ -772,8 +1038,8 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("oauth_state")
 	if err != nil {
 		trackFailedAttempt(clientIP(r))
-		log.Printf("[OAuth] Missing oauth_state cookie from %s: %v", clientIP(r), err)
-		log.Printf("[OAuth] Available cookies: %d present", len(r.Cookies()))
+		logFrom(r.Context()).Warn("Missing oauth_state cookie", securityEvent, "error", err, "cookies_present", len(r.Cookies()))
+		oauthCallbacks.WithLabelValues(oauthMissingStateCookie).Inc()
 		clearStateCookie(w)
 		http.Error(w, "Invalid state", http.StatusBadRequest)
 		return
@@ -782,18 +1048,20 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	// Use constant-time comparison to prevent timing attacks
 	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
 		trackFailedAttempt(clientIP(r))
-		log.Printf("[OAuth] State mismatch from %s", clientIP(r))
+		logFrom(r.Context()).Warn("OAuth state mismatch", securityEvent)
+		oauthCallbacks.WithLabelValues(oauthStateMismatch).Inc()
 		clearStateCookie(w)
 		http.Error(w, "Invalid state", http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[OAuth] State validation successful for %s", clientIP(r))
+	logFrom(r.Context()).Debug("OAuth state validated")
 
 	// Get authorization code
 	code := r.URL.Query().Get("code")
 	if code == "" || len(code) > 512 {
 		trackFailedAttempt(clientIP(r))
+		oauthCallbacks.WithLabelValues(oauthInvalidCode).Inc()
 		clearStateCookie(w)
 		http.Error(w, "Invalid authorization code", http.StatusBadRequest)
 		return
@@ -804,25 +1072,33 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	token, err := exchangeCodeForToken(ctx, code, *redirectURI)
 	if err != nil {
 		trackFailedAttempt(clientIP(r))
-		log.Printf("Failed to exchange code for token: %v", err)
-		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		logFrom(ctx).Error("Failed to exchange code for token", "error", err)
+		oauthCallbacks.WithLabelValues(oauthTokenExchangeFailed).Inc()
+		if !writeGitHubFailure(w, r, err, true) {
+			http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	// Fetch username to determine personal workspace
 	user, err := userInfo(ctx, token)
 	if err != nil {
-		log.Printf("Failed to get user info after OAuth: %v", err)
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		logFrom(ctx).Error("Failed to get user info after OAuth", "error", err)
+		oauthCallbacks.WithLabelValues(oauthUserInfoFailed).Inc()
+		if !writeGitHubFailure(w, r, err, true) {
+			http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	// Validate username format
 	if !isValidGitHubHandle(user.Login) {
-		log.Printf("[SECURITY] Invalid username format from GitHub OAuth: %s", user.Login)
+		logFrom(ctx).Warn("Invalid username format from GitHub OAuth", securityEvent, "login", user.Login)
+		oauthCallbacks.WithLabelValues(oauthInvalidUsername).Inc()
 		http.Error(w, "Invalid username format", http.StatusBadRequest)
 		return
 	}
+	addLogAttrs(ctx, "user", user.Login)
 
 	// Clear the state cookie after all validations pass
 	clearStateCookie(w)
@@ -851,25 +1127,24 @@ func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
 	// Validate and use return_to URL, or default to base domain
 	redirectURL := validateReturnToURL(returnTo)
 	if redirectURL == "" {
-		redirectURL = fmt.Sprintf("%s://%s", scheme, baseDomain)
+		redirectURL = fmt.Sprintf("%s://%s", scheme, *baseDomain)
 	}
 
 	// Create one-time auth code for secure token transfer
+	// Short-lived (10s sufficient for modern browsers)
 	authCode := generateID(32)
-	authCodesMutex.Lock()
-	authCodes[authCode] = authCodeData{
-		token:    token,
-		username: user.Login,
-		expiry:   time.Now().Add(10 * time.Second), // Short-lived (10s sufficient for modern browsers)
-		returnTo: redirectURL,
-		used:     false,
+	if err := storeAuthCode(authCode, token, user.Login, redirectURL, 10*time.Second); err != nil {
+		logFrom(ctx).Error("Failed to store auth code", "error", err)
+		oauthCallbacks.WithLabelValues(oauthAuthCodeStoreFailed).Inc()
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
 	}
-	authCodesMutex.Unlock()
 
 	// Redirect with one-time auth code in fragment (not sent to server)
 	// Fragment identifiers are not sent in Referer headers or logged by servers
 	redirectWithCode := fmt.Sprintf("%s#auth_code=%s", redirectURL, url.QueryEscape(authCode))
-	log.Printf("[OAuth] Redirecting to %s with one-time auth code (in fragment)", sanitizeURL(redirectURL))
+	logFrom(ctx).Info("Redirecting with one-time auth code in fragment", "location", sanitizeURL(redirectURL))
+	oauthCallbacks.WithLabelValues(oauthSuccess).Inc()
 	http.Redirect(w, r, redirectWithCode, http.StatusFound)
 }
 
@@ -887,9 +1162,7 @@ func handleExchangeAuthCode(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	log.Printf("[handleExchangeAuthCode] Called with method=%s path=%s", r.Method, r.URL.Path)
 	if r.Method != http.MethodPost {
-		log.Printf("[handleExchangeAuthCode] Rejecting non-POST request: %s", r.Method)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -902,11 +1175,13 @@ func handleExchangeAuthCode(w http.ResponseWriter, r *http.Request) {
 		AuthCode string `json:"auth_code"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		authCodeExchanges.WithLabelValues(exchangeInvalidRequest).Inc()
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
 
 	if req.AuthCode == "" {
+		authCodeExchanges.WithLabelValues(exchangeInvalidRequest).Inc()
 		http.Error(w, "Missing auth_code", http.StatusBadRequest)
 		return
 	}
@@ -918,21 +1193,24 @@ func handleExchangeAuthCode(w http.ResponseWriter, r *http.Request) {
 	// Perform all validation checks before releasing lock
 	if !exists {
 		authCodesMutex.Unlock()
-		log.Printf("[OAuth] Invalid or expired auth code from %s", clientIP(r))
+		logFrom(r.Context()).Warn("Unknown auth code", securityEvent)
+		authCodeExchanges.WithLabelValues(exchangeUnknownCode).Inc()
 		http.Error(w, "Invalid or expired auth code", http.StatusUnauthorized)
 		return
 	}
 
 	if data.used {
 		authCodesMutex.Unlock()
-		log.Printf("[SECURITY] Attempt to reuse auth code from %s", clientIP(r))
+		logFrom(r.Context()).Warn("Attempt to reuse auth code", securityEvent)
+		authCodeExchanges.WithLabelValues(exchangeReusedCode).Inc()
 		http.Error(w, "Auth code already used", http.StatusUnauthorized)
 		return
 	}
 
 	if time.Now().After(data.expiry) {
 		authCodesMutex.Unlock()
-		log.Printf("[OAuth] Expired auth code from %s", clientIP(r))
+		logFrom(r.Context()).Info("Expired auth code")
+		authCodeExchanges.WithLabelValues(exchangeExpiredCode).Inc()
 		http.Error(w, "Auth code expired", http.StatusUnauthorized)
 		return
 	}
@@ -941,21 +1219,34 @@ func handleExchangeAuthCode(w http.ResponseWriter, r *http.Request) {
 	delete(authCodes, req.AuthCode)
 	authCodesMutex.Unlock()
 
+	// Open the sealed token only for as long as it takes to write the response
+	token, err := authCodeSealer.open(data.sealedToken, req.AuthCode)
+	if err != nil {
+		logFrom(r.Context()).Error("Failed to open sealed token for auth code", securityEvent, "error", err)
+		authCodeExchanges.WithLabelValues(exchangeSealFailure).Inc()
+		http.Error(w, "Invalid or expired auth code", http.StatusUnauthorized)
+		return
+	}
+	defer wipe(token)
+
 	// Return token and username
-	response := struct {
-		Token    string `json:"token"`
-		Username string `json:"username"`
-	}{
-		Token:    data.token,
-		Username: data.username,
+	response, err := tokenResponseJSON(token, data.username)
+	if err != nil {
+		logFrom(r.Context()).Error("Failed to encode auth exchange response", "error", err)
+		authCodeExchanges.WithLabelValues(exchangeResponseFailure).Inc()
+		http.Error(w, "Authentication failed", http.StatusInternalServerError)
+		return
 	}
+	defer wipe(response)
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode auth exchange response: %v", err)
+	if _, err := w.Write(response); err != nil {
+		logFrom(r.Context()).Error("Failed to write auth exchange response", "error", err)
 	}
 
-	log.Printf("[OAuth] Successfully exchanged auth code for user %s", data.username)
+	addLogAttrs(r.Context(), "user", data.username)
+	logFrom(r.Context()).Info("Exchanged auth code")
+	authCodeExchanges.WithLabelValues(exchangeSuccess).Inc()
 }
 
 func handleGetUser(w http.ResponseWriter, r *http.Request) {
@@ -976,14 +1267,17 @@ func handleGetUser(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := userInfo(ctx, token)
 	if err != nil {
-		log.Printf("Failed to get user info: %v", err)
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		logFrom(ctx).Warn("Failed to get user info", "error", err)
+		if !writeGitHubFailure(w, r, err, false) {
+			http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		}
 		return
 	}
+	addLogAttrs(ctx, "user", user.Login)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(user); err != nil {
-		log.Printf("Failed to encode user response: %v", err)
+		logFrom(ctx).Error("Failed to encode user response", "error", err)
 	}
 }
 
@@ -1000,9 +1294,11 @@ func exchangeCodeForToken(ctx context.Context, code, redirectURI string) (string
 
 	var tokenResp oauthTokenResponse
 
-	// Retry with exponential backoff for up to 2 minutes
+	// Retry with exponential backoff while the request's deadline allows
+	ctx, finish := startGitHubCall(ctx, githubCallTokenExchange)
+	budget := &retryBudget{ctx: ctx}
 	err := retry.Do(
-		func() error {
+		instrumentAttempt(ctx, githubCallTokenExchange, func(ctx context.Context) error {
 			// Prepare request
 			data := url.Values{}
 			data.Set("client_id", *clientID)
@@ -1010,13 +1306,13 @@ func exchangeCodeForToken(ctx context.Context, code, redirectURI string) (string
 			data.Set("code", code)
 			data.Set("redirect_uri", redirectURI)
 
-			reqCtx, cancel := context.WithTimeout(ctx, httpTimeout)
+			reqCtx, cancel := context.WithTimeout(ctx, *httpTimeout)
 			defer cancel()
 
 			req, err := http.NewRequestWithContext(
 				reqCtx,
 				http.MethodPost,
-				"https://github.com/login/oauth/access_token",
+				githubURL+"/login/oauth/access_token",
 				strings.NewReader(data.Encode()),
 			)
 			if err != nil {
@@ -1026,32 +1322,21 @@ func exchangeCodeForToken(ctx context.Context, code, redirectURI string) (string
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 			req.Header.Set("Accept", "application/json")
 
-			// Make request with timeout
-			client := &http.Client{
-				Timeout: httpTimeout,
-				CheckRedirect: func(_ *http.Request, via []*http.Request) error {
-					if len(via) >= 3 {
-						return errors.New("too many redirects")
-					}
-					return nil
-				},
-			}
-
-			resp, err := client.Do(req)
+			resp, err := doGitHub(githubCallTokenExchange, req)
 			if err != nil {
-				log.Printf("[RETRY] Token exchange network error (will retry): %v", err)
-				return fmt.Errorf("token exchange failed: %w", err)
+				logFrom(ctx).Warn("Token exchange network error", "error", err)
+				return fmt.Errorf("%w: token exchange failed: %w", errGitHubUnavailable, err)
 			}
 			defer func() {
 				if err := resp.Body.Close(); err != nil {
-					log.Printf("Failed to close response body: %v", err)
+					logFrom(ctx).Warn("Failed to close response body", "error", err)
 				}
 			}()
 
 			// Retry on 5xx server errors
 			if resp.StatusCode >= 500 {
-				log.Printf("[RETRY] Token exchange returned %d (will retry)", resp.StatusCode)
-				return fmt.Errorf("token exchange returned status %d", resp.StatusCode)
+				logFrom(ctx).Warn("Token exchange failed", "status", resp.StatusCode)
+				return fmt.Errorf("%w: token exchange returned status %d", errGitHubUnavailable, resp.StatusCode)
 			}
 
 			// Don't retry on 4xx client errors
@@ -1067,27 +1352,21 @@ func exchangeCodeForToken(ctx context.Context, code, redirectURI string) (string
 
 			// Parse response
 			if err := json.Unmarshal(body, &tokenResp); err != nil {
-				log.Printf("Failed to parse token response: %v", err)
+				logFrom(ctx).Error("Failed to parse token response", "error", err)
 				return retry.Unrecoverable(fmt.Errorf("failed to parse token response: %w", err))
 			}
 
 			if tokenResp.AccessToken == "" {
-				log.Printf("Token response error: %s, description: %s", tokenResp.Error, tokenResp.ErrorDescription)
+				logFrom(ctx).Warn("Token response has no access token", "error_code", tokenResp.Error, "description", tokenResp.ErrorDescription)
 				return retry.Unrecoverable(errors.New("no access token in response"))
 			}
 
 			return nil
-		},
-		retry.Context(ctx),
-		retry.Attempts(10),                  // Reasonable number of attempts for 2 minutes
-		retry.Delay(100*time.Millisecond),   // Initial delay
-		retry.MaxDelay(30*time.Second),      // Cap delay at 30s
-		retry.DelayType(retry.BackOffDelay), // Exponential backoff
-		retry.MaxJitter(1*time.Second),      // Add jitter
-		retry.OnRetry(func(n uint, err error) {
-			log.Printf("[RETRY] Attempt %d: %v", n+1, err)
 		}),
+		githubRetryOptions(ctx, githubCallTokenExchange, budget)...,
 	)
+	err = budget.wrap(err)
+	finish(err)
 	if err != nil {
 		return "", err
 	}
@@ -1105,20 +1384,22 @@ func exchangeCodeForToken(ctx context.Context, code, redirectURI string) (string
 		return "", errors.New("unknown token format")
 	}
 
-	log.Print("Successfully exchanged OAuth code for token")
+	logFrom(ctx).Debug("Exchanged OAuth code for token")
 	return tokenResp.AccessToken, nil
 }
 
 func userInfo(ctx context.Context, token string) (*githubUser, error) {
 	var user githubUser
 
-	// Retry with exponential backoff for up to 2 minutes
+	// Retry with exponential backoff while the request's deadline allows
+	ctx, finish := startGitHubCall(ctx, githubCallUserInfo)
+	budget := &retryBudget{ctx: ctx}
 	err := retry.Do(
-		func() error {
-			reqCtx, cancel := context.WithTimeout(ctx, httpTimeout)
+		instrumentAttempt(ctx, githubCallUserInfo, func(ctx context.Context) error {
+			reqCtx, cancel := context.WithTimeout(ctx, *httpTimeout)
 			defer cancel()
 
-			req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, "https://api.github.com/user", http.NoBody)
+			req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, githubAPIURL+"/user", http.NoBody)
 			if err != nil {
 				return retry.Unrecoverable(err)
 			}
@@ -1126,28 +1407,21 @@ func userInfo(ctx context.Context, token string) (*githubUser, error) {
 			req.Header.Set("Authorization", "Bearer "+token)
 			req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-			client := &http.Client{
-				Timeout: httpTimeout,
-				CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
-					return errors.New("unexpected redirect")
-				},
-			}
-
-			resp, err := client.Do(req)
+			resp, err := doGitHub(githubCallUserInfo, req)
 			if err != nil {
-				log.Printf("[RETRY] GitHub user info network error (will retry): %v", err)
-				return err
+				logFrom(ctx).Warn("GitHub user info network error", "error", err)
+				return fmt.Errorf("%w: %w", errGitHubUnavailable, err)
 			}
 			defer func() {
 				if err := resp.Body.Close(); err != nil {
-					log.Printf("Failed to close response body: %v", err)
+					logFrom(ctx).Warn("Failed to close response body", "error", err)
 				}
 			}()
 
 			// Retry on 5xx server errors
 			if resp.StatusCode >= 500 {
-				log.Printf("[RETRY] GitHub user info returned %d (will retry)", resp.StatusCode)
-				return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+				logFrom(ctx).Warn("GitHub user info failed", "status", resp.StatusCode)
+				return fmt.Errorf("%w: unexpected status: %d", errGitHubUnavailable, resp.StatusCode)
 			}
 
 			// Don't retry on 4xx client errors (including 401 unauthorized)
@@ -1160,22 +1434,16 @@ func userInfo(ctx context.Context, token string) (*githubUser, error) {
 			}
 
 			return nil
-		},
-		retry.Context(ctx),
-		retry.Attempts(10),
-		retry.Delay(100*time.Millisecond),
-		retry.MaxDelay(30*time.Second),
-		retry.DelayType(retry.BackOffDelay),
-		retry.MaxJitter(1*time.Second),
-		retry.OnRetry(func(n uint, err error) {
-			log.Printf("[RETRY] User info attempt %d: %v", n+1, err)
 		}),
+		githubRetryOptions(ctx, githubCallUserInfo, budget)...,
 	)
+	err = budget.wrap(err)
+	finish(err)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Successfully fetched user info for: %s", user.Login)
+	logFrom(ctx).Debug("Fetched user info", "login", user.Login)
 	return &user, nil
 }
 
@@ -1186,14 +1454,17 @@ func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	build := currentBuild()
 	health := struct {
 		Timestamp  time.Time `json:"timestamp"`
 		Status     string    `json:"status"`
 		Version    string    `json:"version"`
+		Revision   string    `json:"revision,omitempty"`
 		OAuthReady bool      `json:"oauth_ready"`
 	}{
 		Status:     "healthy",
-		Version:    "1.0.0",
+		Version:    build.Version,
+		Revision:   build.Revision,
 		Timestamp:  time.Now(),
 		OAuthReady: *clientID != "" && *clientSecret != "",
 	}
@@ -1201,7 +1472,7 @@ func handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(health); err != nil {
-		log.Printf("Failed to encode health response: %v", err)
+		logFrom(r.Context()).Error("Failed to encode health response", "error", err)
 	}
 }
 
@@ -1244,7 +1515,7 @@ func trackFailedAttempt(ip string) {
 	defer failedMutex.Unlock()
 
 	now := time.Now()
-	cutoff := now.Add(-failedLoginWindow)
+	cutoff := now.Add(-*failedLoginWindow)
 
 	// Clean old attempts - reuse slice to reduce allocations
 	valid := failedAttempts[ip][:0]
@@ -1257,8 +1528,8 @@ func trackFailedAttempt(ip string) {
 	failedAttempts[ip] = append(valid, now)
 
 	// Log if there are too many failed attempts
-	if len(failedAttempts[ip]) > maxFailedLogins {
-		log.Printf("[SECURITY] Excessive failed auth attempts: ip=%s count=%d window=15min", ip, len(failedAttempts[ip]))
+	if len(failedAttempts[ip]) > *maxFailedLogins {
+		slog.Warn("Excessive failed auth attempts", securityEvent, "ip", ip, "count", len(failedAttempts[ip]), "window", failedLoginWindow.String())
 	}
 
 	// Prevent memory exhaustion: periodically clean up IPs with no recent failures
@@ -1279,7 +1550,7 @@ func requestSizeLimiter(next http.Handler) http.Handler {
 
 		// Check Content-Length header
 		if r.ContentLength > maxRequestSize {
-			log.Printf("Request too large from %s: %d bytes", clientIP(r), r.ContentLength)
+			logFrom(r.Context()).Warn("Request too large", "content_length", r.ContentLength)
 			http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
 			return
 		}
@@ -1288,34 +1559,38 @@ func requestSizeLimiter(next http.Handler) http.Handler {
 	})
 }
 
-// requestLogger logs all HTTP requests and responses.
-func requestLogger(next http.Handler) http.Handler {
+// requestLogger gives every request a logger carrying its ID, route and client
+// IP, and logs the response. Routes are mux patterns, as for metrics.
+func requestLogger(mux *http.ServeMux, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		requestID := w.Header().Get("X-Request-ID")
+		requestID := ensureRequestID(r)
+		w.Header().Set("X-Request-ID", requestID)
+
+		logger := slog.Default().With(
+			"request_id", requestID,
+			"route", routePattern(mux, r),
+			"ip", clientIP(r),
+		)
+		ctx := withLogScope(r.Context(), logger)
+		r = r.WithContext(ctx)
 
 		// Create a response writer wrapper to capture status code
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
-		// Log request
-		log.Printf("[%s] %s %s %s from %s", requestID, r.Method, r.URL.Path, r.Proto, clientIP(r))
+		logger.Debug("Request started", "method", r.Method, "path", r.URL.Path, "proto", r.Proto)
 
 		next.ServeHTTP(wrapped, r)
 
-		// Log response
-		duration := time.Since(start)
-		log.Printf("[%s] %d %s in %v", requestID, wrapped.statusCode, http.StatusText(wrapped.statusCode), duration)
-
-		// Log security events with structured data
+		// The logger now includes anything handlers learned, such as the user
+		attrs := []any{"method", r.Method, "path", r.URL.Path, "status", wrapped.statusCode, "duration", time.Since(start)}
 		switch wrapped.statusCode {
-		case http.StatusUnauthorized, http.StatusForbidden:
-			log.Printf("[SECURITY] [%s] Unauthorized access: method=%s path=%s ip=%s", requestID, r.Method, r.URL.Path, clientIP(r))
-		case http.StatusTooManyRequests:
-			log.Printf("[SECURITY] [%s] Rate limit exceeded: ip=%s", requestID, clientIP(r))
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+			logFrom(ctx).Warn("Request rejected", append(attrs, securityEvent)...)
 		case http.StatusInternalServerError:
-			log.Printf("[ERROR] [%s] Internal server error: method=%s path=%s ip=%s", requestID, r.Method, r.URL.Path, clientIP(r))
+			logFrom(ctx).Error("Request failed", attrs...)
 		default:
-			// Other status codes don't require special logging
+			logFrom(ctx).Info("Request completed", attrs...)
 		}
 	})
 }
@@ -1335,6 +1610,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	}
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer (for flushing and deadlines).
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	if !rw.written {
 		rw.WriteHeader(http.StatusOK)
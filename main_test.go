@@ -13,23 +13,10 @@ import (
 // with all required origins without errors. This test catches configuration
 // bugs that would cause the server to fail at startup.
 func TestCSRFConfiguration(t *testing.T) {
-	// This test replicates the exact CSRF configuration from main()
+	// This test uses the exact CSRF configuration from main()
 	// to ensure it doesn't fail during server startup
-	csrf := http.NewCrossOriginProtection()
-
-	// Test base domain
-	if err := csrf.AddTrustedOrigin("https://" + baseDomain); err != nil {
-		t.Fatalf("Failed to configure CSRF for base domain: %v", err)
-	}
-
-	// Test subdomain wildcard
-	if err := csrf.AddTrustedOrigin("https://*." + baseDomain); err != nil {
-		t.Fatalf("Failed to configure CSRF for subdomains: %v", err)
-	}
-
-	// Test localhost (covers all ports)
-	if err := csrf.AddTrustedOrigin("http://localhost"); err != nil {
-		t.Fatalf("Failed to configure CSRF for localhost: %v", err)
+	if _, err := newCSRFProtection(); err != nil {
+		t.Fatalf("Failed to configure CSRF protection: %v", err)
 	}
 }
 
@@ -43,12 +30,12 @@ func TestCSRFOriginValidation(t *testing.T) {
 	}{
 		{
 			name:    "https base domain",
-			origin:  "https://" + baseDomain,
+			origin:  "https://" + *baseDomain,
 			wantErr: false,
 		},
 		{
 			name:    "https subdomain wildcard",
-			origin:  "https://*." + baseDomain,
+			origin:  "https://*." + *baseDomain,
 			wantErr: false,
 		},
 		{
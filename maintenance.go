@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maintenanceStatusPath serves the maintenance status for the frontend banner.
+	maintenanceStatusPath = "/maintenance.json"
+
+	defaultMaintenanceMessage = "Sign-in is paused while we perform maintenance."
+
+	// maintenanceRetryAfter is suggested to clients when a window has no end.
+	maintenanceRetryAfter = 5 * time.Minute
+)
+
+// maintenanceWindow is a period during which the OAuth endpoints are closed. A
+// zero Start begins immediately and a zero End lasts until it is turned off.
+type maintenanceWindow struct {
+	Start   time.Time `json:"start,omitzero"`
+	End     time.Time `json:"end,omitzero"`
+	Message string    `json:"message,omitempty"`
+}
+
+// maintenance holds the current or scheduled window, nil when there is none.
+// The config, SIGUSR1/SIGUSR2 and the admin API all replace it; the last
+// change wins.
+var maintenance atomic.Pointer[maintenanceWindow]
+
+// active reports whether the window covers now.
+func (m *maintenanceWindow) active(now time.Time) bool {
+	return m != nil && !now.Before(m.Start) && (m.End.IsZero() || now.Before(m.End))
+}
+
+// retryAfter is how long clients should wait before trying again.
+func (m *maintenanceWindow) retryAfter(now time.Time) time.Duration {
+	if m.End.IsZero() {
+		return maintenanceRetryAfter
+	}
+	return max(m.End.Sub(now).Round(time.Second), time.Second)
+}
+
+func (m *maintenanceWindow) message() string {
+	if m.Message == "" {
+		return defaultMaintenanceMessage
+	}
+	return m.Message
+}
+
+// validate rejects windows that end before they start or have already ended.
+func (m *maintenanceWindow) validate(now time.Time) error {
+	if m.End.IsZero() {
+		return nil
+	}
+	if !m.Start.IsZero() && !m.End.After(m.Start) {
+		return errors.New("end must be after start")
+	}
+	if !m.End.After(now) {
+		return errors.New("end is in the past")
+	}
+	return nil
+}
+
+// parseMaintenanceConfig builds the window configured by --maintenance,
+// --maintenance-start, --maintenance-end and --maintenance-message. It returns
+// nil if none of them turns maintenance on.
+func parseMaintenanceConfig() (*maintenanceWindow, error) {
+	if !*maintenanceMode && *maintenanceStart == "" && *maintenanceEnd == "" {
+		return nil, nil //nolint:nilnil // no window configured
+	}
+	m := &maintenanceWindow{Message: *maintenanceMessage}
+	var err error
+	if *maintenanceStart != "" {
+		if m.Start, err = time.Parse(time.RFC3339, *maintenanceStart); err != nil {
+			return nil, errors.New("maintenance-start must be an RFC 3339 time such as 2026-01-02T15:04:05Z")
+		}
+	}
+	if *maintenanceEnd != "" {
+		if m.End, err = time.Parse(time.RFC3339, *maintenanceEnd); err != nil {
+			return nil, errors.New("maintenance-end must be an RFC 3339 time such as 2026-01-02T15:04:05Z")
+		}
+		if !m.Start.IsZero() && !m.End.After(m.Start) {
+			return nil, errors.New("maintenance-end must be after maintenance-start")
+		}
+	}
+	return m, nil
+}
+
+// setMaintenance replaces the maintenance window, or clears it if m is nil.
+func setMaintenance(m *maintenanceWindow, source string) {
+	maintenance.Store(m)
+	if m == nil {
+		slog.Info("Maintenance mode off", "source", source)
+		return
+	}
+	slog.Info("Maintenance mode set", "source", source, "start", m.Start, "end", m.End, "active", m.active(time.Now()))
+}
+
+// maintenancePage is shown to browsers that reach the OAuth endpoints during maintenance.
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Down for Maintenance - Ready To Review</title>
+    <link rel="stylesheet" href="{{.Stylesheet}}" />
+    <link rel="icon" href="{{.Icon}}" />
+</head>
+<body>
+    <main>
+        <img src="{{.Icon}}" alt="" width="64" height="64" />
+        <h1>Ready To Review is down for maintenance</h1>
+        <p>{{.Message}}</p>
+        {{if .Until}}<p>We expect to be back by {{.Until}}.</p>{{else}}<p>Please try again in a few minutes.</p>{{end}}
+        <p><a href="/">Back to the dashboard</a></p>
+    </main>
+</body>
+</html>
+`))
+
+// duringMaintenance answers with a 503 and Retry-After while a maintenance
+// window is active, as an HTML page or plain text, and otherwise calls next.
+func duringMaintenance(asHTML bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		m := maintenance.Load()
+		if !m.active(now) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		maintenanceRejections.Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(m.retryAfter(now)/time.Second)))
+		w.Header().Set("Cache-Control", "no-store")
+		if !asHTML {
+			http.Error(w, m.message(), http.StatusServiceUnavailable)
+			return
+		}
+
+		var until string
+		if !m.End.IsZero() {
+			until = m.End.UTC().Format("Jan 2, 15:04 MST")
+		}
+		assets := staticAssets.Load()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := maintenancePage.Execute(w, struct {
+			Stylesheet string
+			Icon       string
+			Message    string
+			Until      string
+		}{
+			Stylesheet: assets.url("assets/styles.css"),
+			Icon:       assets.url("assets/icon.svg"),
+			Message:    m.message(),
+			Until:      until,
+		}); err != nil {
+			logFrom(r.Context()).Error("Failed to write maintenance page", "error", err)
+		}
+	})
+}
+
+// maintenanceStatus is the maintenance state shown to the frontend. Scheduled
+// is set for a window that has not started yet, so a banner can announce it.
+type maintenanceStatus struct {
+	Start      time.Time `json:"start,omitzero"`
+	End        time.Time `json:"end,omitzero"`
+	Message    string    `json:"message,omitempty"`
+	RetryAfter int       `json:"retry_after,omitempty"`
+	Active     bool      `json:"active"`
+	Scheduled  bool      `json:"scheduled"`
+}
+
+// currentMaintenanceStatus describes the window at now. Windows that have
+// ended are reported as no maintenance.
+func currentMaintenanceStatus(now time.Time) maintenanceStatus {
+	m := maintenance.Load()
+	if m == nil || (!m.End.IsZero() && !now.Before(m.End)) {
+		return maintenanceStatus{}
+	}
+	status := maintenanceStatus{Start: m.Start, End: m.End, Message: m.message()}
+	if m.active(now) {
+		status.Active = true
+		status.RetryAfter = int(m.retryAfter(now) / time.Second)
+	} else {
+		status.Scheduled = true
+	}
+	return status
+}
+
+func handleMaintenanceStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(currentMaintenanceStatus(time.Now())); err != nil {
+		logFrom(r.Context()).Error("Failed to encode maintenance status", "error", err)
+	}
+}
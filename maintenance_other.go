@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// notifyMaintenanceSignals does nothing: there are no SIGUSR1 and SIGUSR2
+// here, so maintenance is set through the config and the admin API.
+func notifyMaintenanceSignals(context.Context) {}
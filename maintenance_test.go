@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useMaintenance sets the maintenance window for the rest of the test.
+func useMaintenance(t *testing.T, m *maintenanceWindow) {
+	t.Helper()
+	prev := maintenance.Load()
+	t.Cleanup(func() { maintenance.Store(prev) })
+	maintenance.Store(m)
+}
+
+// readMaintenanceStatus fetches the status JSON from handler.
+func readMaintenanceStatus(t *testing.T, handler http.Handler) maintenanceStatus {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, maintenanceStatusPath, http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %d, want 200", maintenanceStatusPath, rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("status Cache-Control = %q, want no-store", got)
+	}
+	var status maintenanceStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	return status
+}
+
+// TestMaintenanceClosesOAuth verifies OAuth endpoints answer 503 during a
+// window while static files and health checks keep working.
+func TestMaintenanceClosesOAuth(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	setupAuthCodeStore(t)
+	exchangeRateLimiter = &rateLimiter{requests: make(map[string][]time.Time), limit: *rateLimitRequests, window: *rateLimitWindow}
+	end := time.Now().Add(time.Hour)
+	useMaintenance(t, &maintenanceWindow{End: end, Message: "Migrating the GitHub App."})
+	handler := newMux(nil)
+
+	for _, tc := range []struct {
+		method, path string
+		html         bool
+	}{
+		{http.MethodGet, "/oauth/login", true},
+		{http.MethodGet, "/oauth/callback?code=abc&state=xyz", true},
+		{http.MethodGet, "/oauth/user", false},
+		{http.MethodPost, "/oauth/exchange", false},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, http.NoBody))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s status = %d, want 503", tc.method, tc.path, rec.Code)
+			continue
+		}
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		if err != nil || retryAfter < 3590 || retryAfter > 3600 {
+			t.Errorf("%s Retry-After = %q, want about an hour", tc.path, rec.Header().Get("Retry-After"))
+		}
+		if got := strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"); got != tc.html {
+			t.Errorf("%s Content-Type = %q, want HTML %v", tc.path, rec.Header().Get("Content-Type"), tc.html)
+		}
+		if !strings.Contains(rec.Body.String(), "Migrating the GitHub App.") {
+			t.Errorf("%s body does not include the message:\n%s", tc.path, rec.Body.String())
+		}
+	}
+
+	for _, path := range []string{"/", "/health", livenessPath, clientConfigPath} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s status = %d during maintenance, want 200", path, rec.Code)
+		}
+	}
+
+	status := readMaintenanceStatus(t, handler)
+	if !status.Active || status.Scheduled || status.Message != "Migrating the GitHub App." || !status.End.Equal(end) {
+		t.Errorf("status = %+v, want active until %v", status, end)
+	}
+}
+
+// TestMaintenanceSchedule verifies a window only closes sign-in between its
+// start and end, and is announced before it starts.
+func TestMaintenanceSchedule(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	handler := newMux(nil)
+	now := time.Now()
+
+	useMaintenance(t, &maintenanceWindow{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/login", http.NoBody))
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Error("login closed before the window starts")
+	}
+	if status := readMaintenanceStatus(t, handler); status.Active || !status.Scheduled || status.Message != defaultMaintenanceMessage {
+		t.Errorf("upcoming window status = %+v, want scheduled with the default message", status)
+	}
+
+	maintenance.Store(&maintenanceWindow{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/login", http.NoBody))
+	if rec.Code == http.StatusServiceUnavailable {
+		t.Error("login still closed after the window ended")
+	}
+	if status := readMaintenanceStatus(t, handler); status != (maintenanceStatus{}) {
+		t.Errorf("ended window status = %+v, want none", status)
+	}
+
+	// Without an end, clients are told to come back after the default delay
+	maintenance.Store(&maintenanceWindow{})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/user", http.NoBody))
+	if got, want := rec.Header().Get("Retry-After"), strconv.Itoa(int(maintenanceRetryAfter/time.Second)); rec.Code != http.StatusServiceUnavailable || got != want {
+		t.Errorf("open-ended window: status = %d, Retry-After = %q, want 503 and %s", rec.Code, got, want)
+	}
+}
+
+// TestAdminMaintenance verifies the admin API starts, schedules and ends maintenance.
+func TestAdminMaintenance(t *testing.T) {
+	useMaintenance(t, nil)
+	handler := newTestAdmin(t)
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body))
+		req.RemoteAddr = "127.0.0.1:1234"
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, `{"message": "Back soon"}`); rec.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if !maintenance.Load().active(time.Now()) {
+		t.Error("maintenance not active after PUT")
+	}
+
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	rec := do(http.MethodPut, `{"start": "`+start+`"}`)
+	var status maintenanceStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil || !status.Scheduled {
+		t.Errorf("scheduled PUT status = %+v (%v), want scheduled", status, err)
+	}
+
+	for _, body := range []string{
+		`{"start": "` + start + `", "end": "` + time.Now().UTC().Format(time.RFC3339) + `"}`,
+		`{"end": "2001-01-01T00:00:00Z"}`,
+		`{"enabled": true}`,
+		`not json`,
+	} {
+		if rec := do(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s status = %d, want 400", body, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE status = %d", rec.Code)
+	}
+	if maintenance.Load() != nil {
+		t.Error("maintenance still set after DELETE")
+	}
+}
+
+func TestParseMaintenanceConfig(t *testing.T) {
+	prevMode, prevStart, prevEnd := *maintenanceMode, *maintenanceStart, *maintenanceEnd
+	t.Cleanup(func() { *maintenanceMode, *maintenanceStart, *maintenanceEnd = prevMode, prevStart, prevEnd })
+
+	*maintenanceMode, *maintenanceStart, *maintenanceEnd = false, "", ""
+	if m, err := parseMaintenanceConfig(); m != nil || err != nil {
+		t.Errorf("parseMaintenanceConfig() = %+v, %v, want no window", m, err)
+	}
+	*maintenanceMode = true
+	if m, err := parseMaintenanceConfig(); err != nil || !m.active(time.Now()) {
+		t.Errorf("--maintenance: parseMaintenanceConfig() = %+v, %v, want an active window", m, err)
+	}
+	*maintenanceMode, *maintenanceStart, *maintenanceEnd = false, "2030-01-01T02:00:00Z", "2030-01-01T04:00:00Z"
+	m, err := parseMaintenanceConfig()
+	if err != nil || m.active(time.Now()) || !m.active(time.Date(2030, 1, 1, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("scheduled: parseMaintenanceConfig() = %+v, %v", m, err)
+	}
+	*maintenanceEnd = "2030-01-01T01:00:00Z"
+	if _, err := parseMaintenanceConfig(); err == nil {
+		t.Error("parseMaintenanceConfig() accepted an end before the start")
+	}
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyMaintenanceSignals lets SIGUSR1 and SIGUSR2 turn maintenance on and
+// off until ctx is done.
+func notifyMaintenanceSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		watchMaintenanceSignals(ctx, signals)
+	}()
+}
+
+// watchMaintenanceSignals turns maintenance on for each SIGUSR1, keeping the
+// configured message, and off for each SIGUSR2 until ctx is done.
+func watchMaintenanceSignals(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR2 {
+				setMaintenance(nil, "signal")
+				continue
+			}
+			setMaintenance(&maintenanceWindow{Message: *maintenanceMessage}, "signal")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMaintenanceSignals verifies SIGUSR1 turns maintenance on and SIGUSR2 off.
+func TestMaintenanceSignals(t *testing.T) {
+	useMaintenance(t, nil)
+	signals := make(chan os.Signal)
+	go watchMaintenanceSignals(t.Context(), signals)
+
+	// Unbuffered sends return once the watcher has the signal; the second
+	// send waits for the first to be applied
+	signals <- syscall.SIGUSR1
+	signals <- syscall.SIGUSR1
+	if !maintenance.Load().active(time.Now()) {
+		t.Error("maintenance not active after SIGUSR1")
+	}
+	signals <- syscall.SIGUSR2
+	signals <- syscall.SIGUSR2
+	if maintenance.Load() != nil {
+		t.Error("maintenance still set after SIGUSR2")
+	}
+}
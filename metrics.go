@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const metricsNamespace = "r2r"
+
+// Outcomes of the OAuth callback. Every exit from handleOAuthCallback reports
+// exactly one of these.
+const (
+	oauthSuccess             = "success"
+	oauthNotConfigured       = "not_configured"
+	oauthDenied              = "denied"
+	oauthAppInstalled        = "app_installed"
+	oauthMissingState        = "missing_state"
+	oauthMissingStateCookie  = "missing_state_cookie"
+	oauthStateMismatch       = "state_mismatch"
+	oauthInvalidCode         = "invalid_code"
+	oauthTokenExchangeFailed = "token_exchange_failed"
+	oauthUserInfoFailed      = "user_info_failed"
+	oauthInvalidUsername     = "invalid_username"
+	oauthAuthCodeStoreFailed = "auth_code_store_failed"
+)
+
+// Outcomes of the one-time auth code exchange.
+const (
+	exchangeSuccess         = "success"
+	exchangeInvalidRequest  = "invalid_request"
+	exchangeUnknownCode     = "unknown_code"
+	exchangeReusedCode      = "reused_code"
+	exchangeExpiredCode     = "expired_code"
+	exchangeSealFailure     = "seal_failure"
+	exchangeResponseFailure = "response_failure"
+)
+
+// GitHub calls and attempt outcomes.
+const (
+	githubCallTokenExchange = "token_exchange"
+	githubCallUserInfo      = "user_info"
+	githubAttemptOK         = "ok"
+	githubAttemptError      = "error"
+)
+
+// otherLabel replaces label values outside the known set.
+const otherLabel = "other"
+
+// metricsRegistry holds the server's metrics. It is separate from the default
+// registry so only what we register here is exported.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route pattern, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	oauthCallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "oauth_callbacks_total",
+		Help:      "OAuth callbacks by outcome.",
+	}, []string{"result"})
+
+	authCodeExchanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_code_exchanges_total",
+		Help:      "One-time auth code exchanges by outcome.",
+	}, []string{"result"})
+
+	githubAttempts = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_attempt_duration_seconds",
+		Help:      "Latency of each attempt at a GitHub call, including retried ones.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"call", "outcome"})
+
+	githubCalls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_call_duration_seconds",
+		Help:      "Latency of GitHub calls including retry backoff.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"call", "outcome"})
+
+	githubRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_retries_total",
+		Help:      "GitHub call attempts that failed and were retried.",
+	}, []string{"call"})
+
+	githubCircuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_circuit_state",
+		Help:      "GitHub circuit breaker state by call: 0 closed, 1 half-open, 2 open.",
+	}, []string{"call"})
+
+	githubCircuitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "github_circuit_rejections_total",
+		Help:      "GitHub calls failed fast because the circuit breaker was open.",
+	}, []string{"call"})
+
+	hostRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "host_rejections_total",
+		Help:      "Untrusted X-Original-Host headers ignored and requests for unknown hosts rejected, by reason.",
+	}, []string{"reason"})
+
+	egressDenials = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "egress_denials_total",
+		Help:      "Outbound requests refused because the host is not in the egress allowlist.",
+	})
+
+	maintenanceRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "maintenance_rejections_total",
+		Help:      "OAuth requests answered with 503 during a maintenance window.",
+	})
+
+	rateLimitRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the auth code exchange rate limiter.",
+	})
+
+	poolInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_in_flight",
+		Help:      "Requests holding a slot in each concurrency pool, its queue depth.",
+	}, []string{"pool"})
+
+	poolLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_limit",
+		Help:      "Slots in each concurrency pool.",
+	}, []string{"pool"})
+
+	poolShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pool_shed_total",
+		Help:      "Requests answered with 503 because their concurrency pool was full.",
+	}, []string{"pool"})
+
+	staticBytesServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "static_bytes_served_total",
+		Help:      "Static file body bytes written, by content encoding.",
+	}, []string{"encoding"})
+)
+
+func init() {
+	for _, call := range []string{githubCallTokenExchange, githubCallUserInfo} {
+		githubCircuitState.WithLabelValues(call).Set(float64(breakerClosed))
+		githubCircuitRejections.WithLabelValues(call)
+	}
+	for _, pool := range []string{poolAuth, poolStatic} {
+		poolInFlight.WithLabelValues(pool)
+		poolShed.WithLabelValues(pool)
+	}
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		oauthCallbacks,
+		authCodeExchanges,
+		githubAttempts,
+		githubCalls,
+		githubRetries,
+		githubCircuitState,
+		githubCircuitRejections,
+		hostRejections,
+		egressDenials,
+		maintenanceRejections,
+		rateLimitRejections,
+		poolInFlight,
+		poolLimit,
+		poolShed,
+		staticBytesServed,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "auth_codes_pending",
+			Help:      "One-time auth codes waiting to be exchanged.",
+		}, func() float64 {
+			authCodesMutex.Lock()
+			defer authCodesMutex.Unlock()
+			return float64(len(authCodes))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "maintenance_active",
+			Help:      "1 while a maintenance window has sign-in closed.",
+		}, func() float64 {
+			if maintenance.Load().active(time.Now()) {
+				return 1
+			}
+			return 0
+		}),
+	)
+}
+
+// metricsHandler serves the registry in the Prometheus text format.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// instrumentRoutes records request counts and latency by route pattern.
+func instrumentRoutes(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped, ok := w.(*responseWriter)
+		if !ok {
+			wrapped = &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		}
+
+		next.ServeHTTP(wrapped, r)
+
+		route := routePattern(mux, r)
+		method := r.Method
+		switch method {
+		case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodOptions:
+		default:
+			method = otherLabel
+		}
+		status := strconv.Itoa(wrapped.statusCode)
+		httpRequests.WithLabelValues(route, method, status).Inc()
+		httpRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routePattern returns the mux pattern that serves r, so route labels are
+// bounded by the registered routes rather than by the paths clients send.
+func routePattern(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return otherLabel
+}
+
+// instrumentAttempt traces and times each attempt of a retried GitHub call.
+// The attempt receives a context carrying its span.
+func instrumentAttempt(ctx context.Context, call string, attempt func(context.Context) error) func() error {
+	var n int
+	return func() error {
+		n++
+		ctx, span := tracer().Start(ctx, "github."+call+".attempt", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("github.call", call), attribute.Int("github.attempt", n)))
+		start := time.Now()
+		err := attempt(ctx)
+		outcome := githubAttemptOK
+		if err != nil {
+			outcome = githubAttemptError
+		}
+		githubAttempts.WithLabelValues(call, outcome).Observe(time.Since(start).Seconds())
+		endSpan(span, err)
+		return err
+	}
+}
+
+// observeGitHubCall records the total latency of a GitHub call started at start.
+func observeGitHubCall(call string, start time.Time, err error) {
+	outcome := githubAttemptOK
+	if err != nil {
+		outcome = githubAttemptError
+	}
+	githubCalls.WithLabelValues(call, outcome).Observe(time.Since(start).Seconds())
+}
+
+// countingWriter counts the body bytes written through it.
+type countingWriter struct {
+	http.ResponseWriter
+
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (c *countingWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestRouteLabelsBounded verifies arbitrary paths share the pattern of the
+// route that served them instead of adding a series per path.
+func TestRouteLabelsBounded(t *testing.T) {
+	setupStaticAssets(t)
+	mux := newMux(nil)
+	handler := instrumentRoutes(mux, mux)
+
+	before := testutil.CollectAndCount(httpRequests)
+	for _, path := range []string{"/random-1", "/random-2/deeper", "/assets/missing.js"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/health", http.NoBody))
+
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/", http.MethodGet, "200")); got < 2 {
+		t.Errorf(`requests{route="/"} = %v, want the unknown paths counted under "/"`, got)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/health", otherLabel, "405")); got != 1 {
+		t.Errorf("unknown method counted %v times under %q, want 1", got, otherLabel)
+	}
+	if added := testutil.CollectAndCount(httpRequests) - before; added > 4 {
+		t.Errorf("4 requests added %d series, want at most 4", added)
+	}
+}
+
+// TestOAuthOutcomeMetrics verifies callback failures are counted by reason.
+func TestOAuthOutcomeMetrics(t *testing.T) {
+	prevSecret := *clientSecret
+	t.Cleanup(func() { *clientSecret = prevSecret })
+	*clientSecret = "test_secret"
+
+	tests := []struct {
+		target string
+		result string
+	}{
+		{target: "/oauth/callback?error=access_denied", result: oauthDenied},
+		{target: "/oauth/callback?code=abc", result: oauthMissingState},
+		{target: "/oauth/callback?code=abc&state=xyz", result: oauthMissingStateCookie},
+	}
+	for _, tt := range tests {
+		before := testutil.ToFloat64(oauthCallbacks.WithLabelValues(tt.result))
+		handleOAuthCallback(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+		if got := testutil.ToFloat64(oauthCallbacks.WithLabelValues(tt.result)) - before; got != 1 {
+			t.Errorf("%s: %s count increased by %v, want 1", tt.target, tt.result, got)
+		}
+	}
+
+	before := testutil.ToFloat64(authCodeExchanges.WithLabelValues(exchangeInvalidRequest))
+	req := httptest.NewRequest(http.MethodPost, "/oauth/exchange", strings.NewReader("not json"))
+	handleExchangeAuthCode(httptest.NewRecorder(), req)
+	if got := testutil.ToFloat64(authCodeExchanges.WithLabelValues(exchangeInvalidRequest)) - before; got != 1 {
+		t.Errorf("invalid exchange count increased by %v, want 1", got)
+	}
+}
+
+// TestGitHubCallMetrics verifies each attempt and retry of a GitHub call is recorded.
+func TestGitHubCallMetrics(t *testing.T) {
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"alice","id":1}`)) //nolint:errcheck // test server
+	}))
+	t.Cleanup(srv.Close)
+	prevAPI := githubAPIURL
+	t.Cleanup(func() { githubAPIURL = prevAPI })
+	githubAPIURL = srv.URL
+
+	retries := testutil.ToFloat64(githubRetries.WithLabelValues(githubCallUserInfo))
+	attempts := testutil.CollectAndCount(githubAttempts)
+	if _, err := userInfo(t.Context(), testToken); err != nil {
+		t.Fatalf("userInfo() error = %v", err)
+	}
+	if got := testutil.ToFloat64(githubRetries.WithLabelValues(githubCallUserInfo)) - retries; got != 1 {
+		t.Errorf("retries increased by %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(githubAttempts); got == 0 || got < attempts {
+		t.Errorf("attempt series = %d, want ok and error attempts recorded", got)
+	}
+}
+
+// TestStaticAndGaugeMetrics verifies static bytes and pending auth codes are exported.
+func TestStaticAndGaugeMetrics(t *testing.T) {
+	setupStaticAssets(t)
+	setupAuthCodeStore(t)
+
+	before := testutil.ToFloat64(staticBytesServed.WithLabelValues(encodingIdentity))
+	rec := httptest.NewRecorder()
+	serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, "/assets/app.js", http.NoBody))
+	if got := testutil.ToFloat64(staticBytesServed.WithLabelValues(encodingIdentity)) - before; got != float64(rec.Body.Len()) {
+		t.Errorf("static bytes increased by %v, want %d", got, rec.Body.Len())
+	}
+
+	authCodesMutex.Lock()
+	authCodes["pending"] = authCodeData{expiry: time.Now().Add(time.Minute)}
+	authCodesMutex.Unlock()
+	rec = httptest.NewRecorder()
+	metricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	if body := rec.Body.String(); !strings.Contains(body, "r2r_auth_codes_pending 1") {
+		t.Errorf("metrics output missing r2r_auth_codes_pending 1")
+	}
+}
+
+// TestAdminMetricsProtected verifies the admin copy of /metrics needs credentials.
+func TestAdminMetricsProtected(t *testing.T) {
+	handler := newTestAdmin(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, adminRequest(http.MethodGet, "/admin/metrics", "127.0.0.1:1234", ""))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, adminRequest(http.MethodGet, "/admin/metrics", "127.0.0.1:1234", testAdminToken))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "r2r_http_requests_total") {
+		t.Errorf("authenticated status = %d, want metrics", rec.Code)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/codeGROOVE-dev/retry"
+)
+
+// Circuit breaker settings for GitHub endpoints.
+const (
+	// breakerThreshold consecutive failures open a breaker.
+	breakerThreshold = 5
+	// breakerCooldown is how long an open breaker fails calls fast before
+	// letting a single probe through.
+	breakerCooldown = 30 * time.Second
+)
+
+// outboundTransport is shared by every call the server makes, so connections
+// to GitHub are pooled and reused across requests and retries.
+var outboundTransport = &http.Transport{
+	Proxy: func(r *http.Request) (*url.URL, error) { return egressProxy(r) },
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   20,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// outboundClient is the client for every outbound call. Timeouts come from
+// each request's context. GitHub's OAuth and API endpoints never redirect, so
+// a redirect is returned to the caller as an unexpected status.
+var outboundClient = &http.Client{
+	Transport: outboundTransport,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// errCircuitOpen is returned without calling GitHub while an endpoint's
+// breaker is open. It wraps errGitHubUnavailable so users get a 503.
+var errCircuitOpen = fmt.Errorf("%w: circuit breaker open", errGitHubUnavailable)
+
+// Breaker states, also the values of the github_circuit_state metric.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerClosed:
+		return "closed"
+	case breakerHalfOpen:
+		return "half_open"
+	case breakerOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// circuitBreaker stops calls to a GitHub endpoint that keeps failing. After
+// threshold consecutive failures it opens and rejects calls for cooldown, then
+// lets one probe through: success closes it, failure opens it again.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(name string) *circuitBreaker {
+	return &circuitBreaker{name: name, threshold: breakerThreshold, cooldown: breakerCooldown}
+}
+
+// githubBreakers holds one breaker per GitHub call.
+var githubBreakers = map[string]*circuitBreaker{
+	githubCallTokenExchange: newCircuitBreaker(githubCallTokenExchange),
+	githubCallUserInfo:      newCircuitBreaker(githubCallUserInfo),
+}
+
+// allow reports whether a call may go ahead. Every allowed call must be
+// followed by exactly one record.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerClosed:
+		return nil
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			break
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if !b.probing {
+			b.probing = true
+			return nil
+		}
+	default:
+	}
+	githubCircuitRejections.WithLabelValues(b.name).Inc()
+	return errCircuitOpen
+}
+
+// Outcomes of a call allowed through a breaker.
+type callOutcome int
+
+const (
+	callSucceeded callOutcome = iota
+	callFailed
+	// callAbandoned says nothing about GitHub, e.g. the caller gave up.
+	callAbandoned
+)
+
+// record reports the outcome of an allowed call.
+func (b *circuitBreaker) record(outcome callOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasProbe := b.probing
+	b.probing = false
+	switch outcome {
+	case callSucceeded:
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+			slog.Info("GitHub circuit breaker closed", "call", b.name)
+		}
+	case callFailed:
+		b.failures++
+		if wasProbe || b.state == breakerClosed && b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			if b.state != breakerOpen {
+				slog.Warn("GitHub circuit breaker opened", "call", b.name, "failures", b.failures)
+			}
+			b.setState(breakerOpen)
+		}
+	default:
+	}
+}
+
+// current returns the breaker's state, treating an open breaker whose
+// cooldown has passed as half-open.
+func (b *circuitBreaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) setState(s breakerState) {
+	b.state = s
+	githubCircuitState.WithLabelValues(b.name).Set(float64(s))
+}
+
+// doGitHub sends req with the shared client through call's breaker. Network
+// errors and 5xx responses count against the breaker; a cancelled caller or a
+// refused egress does not. An open breaker and a refused egress are not
+// worth retrying.
+func doGitHub(call string, req *http.Request) (*http.Response, error) {
+	breaker := githubBreakers[call]
+	if err := breaker.allow(); err != nil {
+		return nil, retry.Unrecoverable(err)
+	}
+	resp, err := outboundClient.Do(req)
+	switch {
+	case errors.Is(err, errEgressDenied):
+		breaker.record(callAbandoned)
+		return nil, retry.Unrecoverable(err)
+	case errors.Is(err, context.Canceled):
+		breaker.record(callAbandoned)
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		breaker.record(callFailed)
+	default:
+		breaker.record(callSucceeded)
+	}
+	return resp, err
+}
+
+// githubCircuitStates reports each GitHub breaker's state for /readyz. An open
+// breaker does not fail readiness: every instance shares the same GitHub, so
+// they would all go unready at once and take down the routes that do not need
+// GitHub with them.
+func githubCircuitStates() map[string]string {
+	states := make(map[string]string, len(githubBreakers))
+	for name, b := range githubBreakers {
+		states[name] = b.current().String()
+	}
+	return states
+}
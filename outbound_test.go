@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// resetBreakers closes every GitHub breaker before and after the test.
+func resetBreakers(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		for _, b := range githubBreakers {
+			b.mu.Lock()
+			b.failures, b.probing, b.openedAt, b.cooldown = 0, false, time.Time{}, breakerCooldown
+			b.setState(breakerClosed)
+			b.mu.Unlock()
+		}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// TestCircuitBreaker verifies a failing endpoint opens its breaker, calls then
+// fail fast without reaching GitHub, and a successful probe closes it again.
+func TestCircuitBreaker(t *testing.T) {
+	resetReadiness(t)
+	var failing atomic.Bool
+	failing.Store(true)
+	hits := useFlakyGitHub(t, func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"alice","id":1}`)) //nolint:errcheck // test server
+	})
+	breaker := githubBreakers[githubCallUserInfo]
+
+	// Retries within one call trip the breaker, which ends the call early.
+	_, err := userInfo(t.Context(), testToken)
+	if !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("userInfo() error = %v, want circuit open", err)
+	}
+	if got := hits.Load(); got != breakerThreshold {
+		t.Errorf("GitHub called %d times, want %d", got, breakerThreshold)
+	}
+	if got := testutil.ToFloat64(githubCircuitState.WithLabelValues(githubCallUserInfo)); got != float64(breakerOpen) {
+		t.Errorf("circuit state metric = %v, want open", got)
+	}
+	if got := githubCircuitStates()[githubCallUserInfo]; got != "open" {
+		t.Errorf("reported circuit state = %q, want open", got)
+	}
+
+	// While open, calls fail fast and answer 503.
+	rejected := testutil.ToFloat64(githubCircuitRejections.WithLabelValues(githubCallUserInfo))
+	start := time.Now()
+	_, err = userInfo(t.Context(), testToken)
+	if !errors.Is(err, errCircuitOpen) || time.Since(start) > 50*time.Millisecond {
+		t.Errorf("userInfo() with open breaker = %v after %v, want a fast circuit open error", err, time.Since(start))
+	}
+	if got := hits.Load(); got != breakerThreshold {
+		t.Errorf("open breaker let a call through (%d hits)", got)
+	}
+	if code, _ := githubFailureStatus(err); code != http.StatusServiceUnavailable {
+		t.Errorf("githubFailureStatus() = %d, want 503", code)
+	}
+	if got := testutil.ToFloat64(githubCircuitRejections.WithLabelValues(githubCallUserInfo)); got != rejected+1 {
+		t.Errorf("rejections = %v, want %v", got, rejected+1)
+	}
+
+	// After the cooldown one probe is let through and success closes the breaker.
+	failing.Store(false)
+	breaker.mu.Lock()
+	breaker.openedAt = time.Now().Add(-breaker.cooldown)
+	breaker.mu.Unlock()
+	if _, err := userInfo(t.Context(), testToken); err != nil {
+		t.Fatalf("userInfo() after cooldown error = %v", err)
+	}
+	if breaker.current() != breakerClosed {
+		t.Errorf("breaker = %v after a successful probe, want closed", breaker.current())
+	}
+	if got := githubCircuitStates()[githubCallUserInfo]; got != "closed" {
+		t.Errorf("reported circuit state = %q, want closed", got)
+	}
+}
+
+// TestCircuitBreakerHalfOpen verifies only one probe runs at a time and a
+// failed probe reopens the breaker.
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	b := &circuitBreaker{name: "test", threshold: 1, cooldown: time.Hour}
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.record(callFailed)
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("allow() on open breaker = %v", err)
+	}
+
+	b.openedAt = time.Now().Add(-time.Hour)
+	if err := b.allow(); err != nil {
+		t.Fatalf("allow() after cooldown = %v, want a probe", err)
+	}
+	if err := b.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("second allow() while probing = %v, want circuit open", err)
+	}
+	b.record(callFailed)
+	if b.current() != breakerOpen {
+		t.Errorf("breaker = %v after failed probe, want open", b.current())
+	}
+
+	// A caller giving up says nothing about GitHub and frees the probe slot.
+	b.openedAt = time.Now().Add(-time.Hour)
+	if err := b.allow(); err != nil {
+		t.Fatal(err)
+	}
+	b.record(callAbandoned)
+	if err := b.allow(); err != nil {
+		t.Errorf("allow() after abandoned probe = %v, want another probe", err)
+	}
+}
+
+// TestOutboundConnectionReuse verifies retries and separate calls share pooled
+// connections instead of dialing GitHub each time.
+func TestOutboundConnectionReuse(t *testing.T) {
+	resetBreakers(t)
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"alice","id":1}`)) //nolint:errcheck // test server
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	prevAPI := githubAPIURL
+	t.Cleanup(func() { githubAPIURL = prevAPI })
+	githubAPIURL = srv.URL
+
+	for range 5 {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		if _, err := userInfo(ctx, testToken); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+	}
+	if got := conns.Load(); got != 1 {
+		t.Errorf("opened %d connections for 5 calls, want 1", got)
+	}
+}
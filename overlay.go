@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// overlayFS layers an override filesystem over a base filesystem. Files in the
+// override take precedence; directories are merged so new files can be added.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+// newOverlayFS returns a filesystem where files in upper shadow those in lower.
+func newOverlayFS(upper, lower fs.FS) *overlayFS {
+	return &overlayFS{upper: upper, lower: lower}
+}
+
+// openOverrideFS opens dir for use as an asset override. The returned filesystem
+// is rooted with os.Root, so symlinks and ".." cannot escape the directory.
+func openOverrideFS(dir string) (fs.FS, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS(), nil
+}
+
+// isOverridablePath reports whether an override may supply name. Hidden files and
+// names that serveStaticFiles would refuse to serve are never taken from the override.
+func isOverridablePath(name string) bool {
+	if !fs.ValidPath(name) || strings.Contains(name, "~") {
+		return false
+	}
+	for part := range strings.SplitSeq(name, "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if isOverridablePath(name) {
+		f, err := o.upper.Open(name)
+		if err == nil {
+			info, statErr := f.Stat()
+			// Directories are merged through ReadDir; only regular files shadow the base
+			if statErr == nil && info.Mode().IsRegular() {
+				return f, nil
+			}
+			if closeErr := f.Close(); closeErr != nil {
+				slog.Warn("Failed to close override", "name", name, "error", closeErr)
+			}
+			if statErr == nil && !info.IsDir() {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	f, err := o.lower.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	// A directory that only exists in the override
+	if isOverridablePath(name) {
+		return o.upper.Open(name)
+	}
+	return nil, err
+}
+
+// ReadDir merges directory listings, with override entries replacing base entries
+// of the same name.
+func (o *overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	merged := make(map[string]fs.DirEntry)
+	lowerEntries, lowerErr := fs.ReadDir(o.lower, name)
+	if lowerErr != nil && !errors.Is(lowerErr, fs.ErrNotExist) {
+		return nil, lowerErr
+	}
+	for _, e := range lowerEntries {
+		merged[e.Name()] = e
+	}
+
+	var upperErr error = fs.ErrNotExist
+	if isOverridablePath(name) {
+		var upperEntries []fs.DirEntry
+		upperEntries, upperErr = fs.ReadDir(o.upper, name)
+		if upperErr != nil && !errors.Is(upperErr, fs.ErrNotExist) {
+			return nil, upperErr
+		}
+		for _, e := range upperEntries {
+			child := e.Name()
+			if name != "." {
+				child = name + "/" + child
+			}
+			if !isOverridablePath(child) {
+				continue
+			}
+			// Only regular files and directories are served from the override.
+			// Symlinks are listed as their target; os.Root refuses those
+			// leaving the directory.
+			if e.Type()&fs.ModeSymlink != 0 {
+				info, err := fs.Stat(o.upper, child)
+				if err != nil {
+					slog.Debug("Ignoring override symlink", "name", child, "error", err)
+					continue
+				}
+				e = fs.FileInfoToDirEntry(info)
+			}
+			if !e.Type().IsRegular() && !e.IsDir() {
+				continue
+			}
+			merged[e.Name()] = e
+		}
+	}
+
+	if lowerErr != nil && upperErr != nil {
+		return nil, lowerErr
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOverlayAssetsOverride verifies override files shadow and extend the embedded ones.
+func TestOverlayAssetsOverride(t *testing.T) {
+	previous := staticAssets.Load()
+	t.Cleanup(func() { staticAssets.Store(previous) })
+
+	dir := t.TempDir()
+	writeDevFile(t, dir, "assets/styles.css", "body { color: hotpink; }")
+	writeDevFile(t, dir, "assets/logo.svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`)
+	writeDevFile(t, dir, "assets/.secret", "hidden")
+	writeDevFile(t, dir, "main.go", "package main")
+
+	override, err := openOverrideFS(dir)
+	if err != nil {
+		t.Fatalf("openOverrideFS() error = %v", err)
+	}
+	store, err := newAssetStore(newOverlayFS(override, staticFiles), true)
+	if err != nil {
+		t.Fatalf("newAssetStore() error = %v", err)
+	}
+	staticAssets.Store(store)
+
+	css, ok := store.assets["assets/styles.css"]
+	if !ok || string(css.data) != "body { color: hotpink; }" {
+		t.Fatal("override did not replace assets/styles.css")
+	}
+	if css.hashedName == "" {
+		t.Error("override was not fingerprinted")
+	}
+	if !strings.Contains(string(store.assets["index.html"].data), pathpkg.Base(css.hashedName)) {
+		t.Error("index.html does not reference the fingerprinted override")
+	}
+	if _, ok := store.assets["assets/app.js"]; !ok {
+		t.Error("embedded assets/app.js missing from overlay")
+	}
+	if _, ok := store.assets["assets/logo.svg"]; !ok {
+		t.Error("new override file assets/logo.svg was not added")
+	}
+	if _, ok := store.assets["assets/.secret"]; ok {
+		t.Error("hidden override file was served")
+	}
+	if _, ok := store.assets["main.go"]; ok {
+		t.Error("file outside the static roots was served")
+	}
+
+	rec := httptest.NewRecorder()
+	serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, "/"+css.hashedName, http.NoBody))
+	if !strings.Contains(rec.Header().Get("Cache-Control"), "immutable") || rec.Header().Get("ETag") == "" {
+		t.Errorf("override headers = %v, want immutable caching with ETag", rec.Header())
+	}
+}
+
+// TestOverlayFollowsInternalSymlinks verifies symlinks within the override
+// directory are listed and served like the files they point to.
+func TestOverlayFollowsInternalSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeDevFile(t, dir, "shared/brand.css", "body { color: teal; }")
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "shared", "brand.css"), filepath.Join(dir, "assets", "brand.css")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	override, err := openOverrideFS(dir)
+	if err != nil {
+		t.Fatalf("openOverrideFS() error = %v", err)
+	}
+	overlay := newOverlayFS(override, staticFiles)
+
+	entries, err := fs.ReadDir(overlay, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed bool
+	for _, e := range entries {
+		if e.Name() == "brand.css" {
+			listed = e.Type().IsRegular()
+		}
+	}
+	if !listed {
+		t.Error("ReadDir does not list the symlink as a regular file")
+	}
+	if data, err := fs.ReadFile(overlay, "assets/brand.css"); err != nil || !strings.Contains(string(data), "teal") {
+		t.Errorf("ReadFile(assets/brand.css) = %q, %v", data, err)
+	}
+}
+
+// TestOverlayRejectsEscapes verifies the override cannot reach outside its directory.
+func TestOverlayRejectsEscapes(t *testing.T) {
+	outside := t.TempDir()
+	writeDevFile(t, outside, "secret.txt", "top secret")
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "assets", "leak.js")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	override, err := openOverrideFS(dir)
+	if err != nil {
+		t.Fatalf("openOverrideFS() error = %v", err)
+	}
+	overlay := newOverlayFS(override, staticFiles)
+
+	if data, err := fs.ReadFile(overlay, "assets/leak.js"); err == nil {
+		t.Errorf("read through escaping symlink succeeded: %q", data)
+	}
+	entries, err := fs.ReadDir(overlay, "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() == "leak.js" {
+			t.Error("ReadDir lists the escaping symlink")
+		}
+	}
+	for _, name := range []string{"../secret.txt", "assets/../../secret.txt", "/etc/passwd"} {
+		if _, err := overlay.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q) error = %v, want fs.ErrInvalid", name, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Concurrency pools. Auth routes call GitHub and can be slow, so they get their
+// own pool and a flood of them cannot starve static files.
+const (
+	poolAuth   = "auth"
+	poolStatic = "static"
+
+	// shedRetryAfter is suggested to clients whose request was shed. Slots
+	// free up as soon as in-flight requests finish, so it is short.
+	shedRetryAfter = 2 * time.Second
+)
+
+// concurrencyPool caps the requests served at once. Requests beyond the cap
+// are shed immediately rather than queued, so a backlog can never build up.
+type concurrencyPool struct {
+	slots chan struct{}
+	name  string
+}
+
+func newConcurrencyPool(name string, limit int) *concurrencyPool {
+	poolLimit.WithLabelValues(name).Set(float64(limit))
+	return &concurrencyPool{name: name, slots: make(chan struct{}, limit)}
+}
+
+// limit serves next while a slot is free and answers 503 with Retry-After otherwise.
+func (p *concurrencyPool) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case p.slots <- struct{}{}:
+		default:
+			poolShed.WithLabelValues(p.name).Inc()
+			logFrom(r.Context()).Debug("Shed request, concurrency pool full", "pool", p.name, "limit", cap(p.slots))
+			w.Header().Set("Retry-After", strconv.Itoa(int(shedRetryAfter/time.Second)))
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "Server busy, please try again", http.StatusServiceUnavailable)
+			return
+		}
+		inFlight := poolInFlight.WithLabelValues(p.name)
+		inFlight.Inc()
+		defer func() {
+			inFlight.Dec()
+			<-p.slots
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// useConcurrencyLimits sets the pool sizes newMux uses for the test.
+func useConcurrencyLimits(tb testing.TB, auth, static int) {
+	tb.Helper()
+	prevAuth, prevStatic := *maxAuthRequests, *maxStaticRequests
+	tb.Cleanup(func() { *maxAuthRequests, *maxStaticRequests = prevAuth, prevStatic })
+	*maxAuthRequests, *maxStaticRequests = auth, static
+}
+
+// saturateAuthPool fills the auth pool of handler with n /oauth/user requests
+// that hang at a fake GitHub until the test ends.
+func saturateAuthPool(tb testing.TB, handler http.Handler, n int) {
+	tb.Helper()
+	arrived, release := make(chan struct{}), make(chan struct{})
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Retries after a long benchmark's deadline arrive when no one is waiting
+		select {
+		case arrived <- struct{}{}:
+		case <-release:
+		}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(githubUser{Login: "alice", ID: 1}) //nolint:errcheck // test server
+	}))
+	prevAPI := githubAPIURL
+	githubAPIURL = github.URL
+
+	var wg sync.WaitGroup
+	tb.Cleanup(func() {
+		close(release)
+		wg.Wait()
+		github.Close()
+		githubAPIURL = prevAPI
+	})
+	for range n {
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, "/oauth/user", http.NoBody)
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+	for range n {
+		<-arrived
+	}
+}
+
+// TestConcurrencyPoolSheds verifies requests beyond a full pool get a 503 with
+// Retry-After straight away and are counted.
+func TestConcurrencyPoolSheds(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	useConcurrencyLimits(t, 2, 8)
+	handler := newMux(nil)
+	shedBefore := testutil.ToFloat64(poolShed.WithLabelValues(poolAuth))
+	saturateAuthPool(t, handler, 2)
+
+	if got := testutil.ToFloat64(poolInFlight.WithLabelValues(poolAuth)); got != 2 {
+		t.Errorf("auth pool in flight = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(poolLimit.WithLabelValues(poolAuth)); got != 2 {
+		t.Errorf("auth pool limit = %v, want 2", got)
+	}
+
+	for _, path := range []string{"/oauth/user", "/oauth/login", "/oauth/callback?code=abc&state=xyz"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+			t.Errorf("%s with the auth pool full: status = %d, Retry-After = %q, want 503 and 2",
+				path, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+	if got := testutil.ToFloat64(poolShed.WithLabelValues(poolAuth)) - shedBefore; got != 3 {
+		t.Errorf("auth requests shed = %v, want 3", got)
+	}
+
+	// Static files, frontend config and health checks use other pools or none
+	for _, path := range []string{"/", clientConfigPath, maintenanceStatusPath, "/health", livenessPath} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s with the auth pool full: status = %d, want 200", path, rec.Code)
+		}
+	}
+}
+
+// TestConcurrencyPoolReleasesSlots verifies slots are returned after each request.
+func TestConcurrencyPoolReleasesSlots(t *testing.T) {
+	pool := newConcurrencyPool("test", 1)
+	handler := pool.limit(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for i := range 3 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+		if rec.Code != http.StatusOK {
+			t.Errorf("request %d: status = %d, want 200", i, rec.Code)
+		}
+	}
+	if got := testutil.ToFloat64(poolInFlight.WithLabelValues("test")); got != 0 {
+		t.Errorf("in flight after requests finished = %v, want 0", got)
+	}
+}
+
+// BenchmarkStaticWhileAuthSaturated serves the dashboard in parallel while
+// every auth slot is held by a request stuck on GitHub. Every static request
+// must still succeed.
+func BenchmarkStaticWhileAuthSaturated(b *testing.B) {
+	useBaseDomain(b, "example.test")
+	useConcurrencyLimits(b, 4, 1024)
+	handler := newMux(nil)
+	saturateAuthPool(b, handler, 4)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/user", http.NoBody))
+	if rec.Code != http.StatusServiceUnavailable {
+		b.Fatalf("auth request with the pool full: status = %d, want 503", rec.Code)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.Header.Set("Accept-Encoding", "gzip")
+			handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK {
+				b.Errorf("static request while auth is saturated: status = %d, want 200", rec.Code)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Offline support endpoints. They live at the root so the service worker can
+// control every dashboard route.
+const (
+	serviceWorkerPath   = "/sw.js"
+	precacheListPath    = "/precache-manifest.json"
+	webAppManifestPath  = "/manifest.webmanifest"
+	webAppIcon          = "assets/icon.svg"
+	webAppThemeColor    = "#6366f1"
+	serviceWorkerPrefix = "r2r-shell-"
+)
+
+// precacheEntry is a URL the service worker stores for offline use.
+type precacheEntry struct {
+	URL      string `json:"url"`
+	Revision string `json:"revision"`
+}
+
+// serviceWorkerTemplate caches the dashboard shell. Precached assets are served
+// cache-first (their URLs are content-hashed), navigations are network-first with
+// the cached shell as the offline fallback, and everything else (OAuth, the GitHub
+// API, avatars) is left to the browser.
+const serviceWorkerTemplate = `// Generated by the dashboard server. Do not edit.
+const CACHE = %q;
+const BASE_DOMAIN = %q;
+const PRECACHE = %s;
+const PRECACHED_PATHS = new Set(PRECACHE.map((entry) => entry.url));
+
+self.addEventListener("install", (event) => {
+  event.waitUntil(
+    caches
+      .open(CACHE)
+      .then((cache) => cache.addAll(PRECACHE.map((entry) => entry.url)))
+      .then(() => self.skipWaiting())
+  );
+});
+
+self.addEventListener("activate", (event) => {
+  event.waitUntil(
+    caches
+      .keys()
+      .then((keys) =>
+        Promise.all(
+          keys
+            .filter((key) => key.startsWith(%q) && key !== CACHE)
+            .map((key) => caches.delete(key))
+        )
+      )
+      .then(() => self.clients.claim())
+  );
+});
+
+// Assets are referenced from the base domain on workspace subdomains
+const isOurHost = (url) =>
+  url.origin === self.location.origin ||
+  url.hostname === BASE_DOMAIN ||
+  url.hostname.endsWith("." + BASE_DOMAIN);
+
+self.addEventListener("fetch", (event) => {
+  const request = event.request;
+  if (request.method !== "GET") return;
+  const url = new URL(request.url);
+  if (!isOurHost(url)) return;
+
+  if (request.mode === "navigate") {
+    if (url.pathname.startsWith("/oauth/")) return;
+    event.respondWith(fetch(request).catch(() => caches.match("/")));
+    return;
+  }
+
+  if (PRECACHED_PATHS.has(url.pathname)) {
+    event.respondWith(
+      caches.match(url.pathname).then((cached) => cached || fetch(url.pathname))
+    );
+  }
+});
+`
+
+// precacheList returns the shell and every fingerprinted script, stylesheet and
+// image, with content hashes as revisions.
+func (s *assetStore) precacheList() []precacheEntry {
+	entries := []precacheEntry{}
+	if index, ok := s.assets["index.html"]; ok {
+		entries = append(entries, precacheEntry{URL: "/", Revision: strings.Trim(index.etag, `"`)})
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.assets)) {
+		asset := s.assets[name]
+		if asset.hashedName == "" {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, ".js"), strings.HasSuffix(name, ".css"), strings.HasSuffix(name, ".svg"):
+			entries = append(entries, precacheEntry{URL: "/" + asset.hashedName, Revision: strings.Trim(asset.etag, `"`)})
+		default:
+			// Large images are fetched on demand
+		}
+	}
+	return entries
+}
+
+// serviceWorker renders the service worker script for the store's precache list.
+func (s *assetStore) serviceWorker() ([]byte, error) {
+	list, err := json.Marshal(s.precacheList())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(list)
+	cache := serviceWorkerPrefix + hex.EncodeToString(sum[:8])
+	return fmt.Appendf(nil, serviceWorkerTemplate, cache, *baseDomain, list, serviceWorkerPrefix), nil
+}
+
+// webAppManifest renders the manifest that makes the dashboard installable.
+func (s *assetStore) webAppManifest() ([]byte, error) {
+	type icon struct {
+		Src     string `json:"src"`
+		Sizes   string `json:"sizes"`
+		Type    string `json:"type"`
+		Purpose string `json:"purpose"`
+	}
+	return json.Marshal(struct {
+		Name            string `json:"name"`
+		ShortName       string `json:"short_name"`
+		Description     string `json:"description"`
+		StartURL        string `json:"start_url"`
+		Scope           string `json:"scope"`
+		Display         string `json:"display"`
+		BackgroundColor string `json:"background_color"`
+		ThemeColor      string `json:"theme_color"`
+		Icons           []icon `json:"icons"`
+	}{
+		Name:            "Ready To Review",
+		ShortName:       "Ready To Review",
+		Description:     "A modern dashboard for managing GitHub pull requests",
+		StartURL:        "/",
+		Scope:           "/",
+		Display:         "standalone",
+		BackgroundColor: "#ffffff",
+		ThemeColor:      webAppThemeColor,
+		Icons: []icon{
+			{Src: s.url(webAppIcon), Sizes: "any", Type: "image/svg+xml", Purpose: "any"},
+		},
+	})
+}
+
+// servePWAFile serves a document generated from the current asset store.
+func servePWAFile(w http.ResponseWriter, r *http.Request, name, contentType string, render func(*assetStore) ([]byte, error)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	assets := staticAssets.Load()
+	data, err := render(assets)
+	if err != nil {
+		logFrom(r.Context()).Error("Failed to render PWA file", "name", name, "error", err)
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", contentType)
+	// Browsers must see a new service worker or manifest as soon as assets change
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, name, assets.modTime, bytes.NewReader(data))
+}
+
+func handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Service-Worker-Allowed", "/")
+	servePWAFile(w, r, "sw.js", "application/javascript; charset=utf-8", (*assetStore).serviceWorker)
+}
+
+func handlePrecacheList(w http.ResponseWriter, r *http.Request) {
+	servePWAFile(w, r, "precache-manifest.json", "application/json; charset=utf-8", func(s *assetStore) ([]byte, error) {
+		return json.Marshal(s.precacheList())
+	})
+}
+
+func handleWebAppManifest(w http.ResponseWriter, r *http.Request) {
+	servePWAFile(w, r, "manifest.webmanifest", "application/manifest+json", (*assetStore).webAppManifest)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServiceWorker verifies the generated service worker and its precache list.
+func TestServiceWorker(t *testing.T) {
+	setupStaticAssets(t)
+	store := staticAssets.Load()
+	appURL := "/" + store.assets["assets/app.js"].hashedName
+
+	rec := httptest.NewRecorder()
+	handleServiceWorker(rec, httptest.NewRequest(http.MethodGet, serviceWorkerPath, http.NoBody))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":           "application/javascript; charset=utf-8",
+		"Cache-Control":          "no-cache",
+		"Service-Worker-Allowed": "/",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if !strings.Contains(rec.Body.String(), `"url":"`+appURL+`"`) {
+		t.Errorf("service worker does not precache %s", appURL)
+	}
+
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, serviceWorkerPath, http.NoBody)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handleServiceWorker(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	var list []precacheEntry
+	rec = httptest.NewRecorder()
+	handlePrecacheList(rec, httptest.NewRequest(http.MethodGet, precacheListPath, http.NoBody))
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode precache list: %v", err)
+	}
+	if len(list) == 0 || list[0].URL != "/" {
+		t.Fatalf("precache list = %+v, want the shell first", list)
+	}
+	for _, entry := range list[1:] {
+		canonical, ok := store.hashed[strings.TrimPrefix(entry.URL, "/")]
+		if !ok {
+			t.Errorf("precache entry %s is not a fingerprinted asset", entry.URL)
+			continue
+		}
+		if want := strings.Trim(store.assets[canonical].etag, `"`); entry.Revision != want {
+			t.Errorf("precache entry %s revision = %s, want %s", entry.URL, entry.Revision, want)
+		}
+	}
+}
+
+// TestWebAppManifest verifies the manifest that makes the dashboard installable.
+func TestWebAppManifest(t *testing.T) {
+	setupStaticAssets(t)
+
+	rec := httptest.NewRecorder()
+	handleWebAppManifest(rec, httptest.NewRequest(http.MethodGet, webAppManifestPath, http.NoBody))
+	if got := rec.Header().Get("Content-Type"); got != "application/manifest+json" {
+		t.Errorf("Content-Type = %q, want application/manifest+json", got)
+	}
+	var manifest struct {
+		StartURL string `json:"start_url"`
+		Display  string `json:"display"`
+		Icons    []struct {
+			Src string `json:"src"`
+		} `json:"icons"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &manifest); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if manifest.StartURL != "/" || manifest.Display != "standalone" || len(manifest.Icons) == 0 {
+		t.Fatalf("manifest = %+v, want installable standalone app", manifest)
+	}
+	if icon := manifest.Icons[0].Src; icon != "/"+staticAssets.Load().assets[webAppIcon].hashedName {
+		t.Errorf("icon = %s, want fingerprinted %s", icon, webAppIcon)
+	}
+
+	rec = httptest.NewRecorder()
+	securityHeaders(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	csp := rec.Header().Get("Content-Security-Policy")
+	for _, directive := range []string{"worker-src 'self'", "manifest-src 'self'"} {
+		if !strings.Contains(csp, directive) {
+			t.Errorf("CSP missing %q", directive)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/codeGROOVE-dev/retry"
+)
+
+// Secret Manager is called over its REST API with outboundClient, so the egress
+// proxy, CA bundle and allowlist apply to it like to any other call. The
+// metadata server supplying the project and access token is link-local; it is
+// never proxied but is still subject to the allowlist.
+var (
+	metadataURL      = "http://metadata.google.internal/computeMetadata/v1"
+	secretManagerURL = "https://secretmanager.googleapis.com/v1"
+)
+
+const (
+	secretFetchAttempts = 3
+	secretFetchDelay    = time.Second
+	// maxSecretResponse bounds responses; Secret Manager payloads are at most 64 KiB.
+	maxSecretResponse = 1 << 20
+)
+
+// metadataClient reaches the metadata server directly.
+var metadataClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:       func(r *http.Request) (*url.URL, error) { return nil, checkEgress(r) },
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second}).DialContext,
+	},
+	Timeout: 10 * time.Second,
+}
+
+// fetchSecret returns the latest version of the named secret in the project
+// the server runs in, authenticating as the instance's service account.
+func fetchSecret(ctx context.Context, name string) (string, error) {
+	project, err := secretManagerGet(ctx, metadataClient, metadataURL+"/project/project-id", "Metadata-Flavor", "Google")
+	if err != nil {
+		return "", fmt.Errorf("project ID: %w", err)
+	}
+	tokenJSON, err := secretManagerGet(ctx, metadataClient, metadataURL+"/instance/service-accounts/default/token", "Metadata-Flavor", "Google")
+	if err != nil {
+		return "", fmt.Errorf("access token: %w", err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(tokenJSON, &token); err != nil || token.AccessToken == "" {
+		return "", errors.New("access token: metadata server returned no token")
+	}
+
+	secretURL := secretManagerURL + "/projects/" + url.PathEscape(string(project)) +
+		"/secrets/" + url.PathEscape(name) + "/versions/latest:access"
+	body, err := secretManagerGet(ctx, outboundClient, secretURL, "Authorization", "Bearer "+token.AccessToken)
+	if err != nil {
+		return "", fmt.Errorf("access secret: %w", err)
+	}
+	var version struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		return "", fmt.Errorf("decode secret: %w", err)
+	}
+	return string(version.Payload.Data), nil
+}
+
+// secretManagerGet fetches rawURL with one extra header, retrying network
+// errors and 5xx responses.
+func secretManagerGet(ctx context.Context, client *http.Client, rawURL, header, value string) ([]byte, error) {
+	return retry.DoWithData(
+		func() ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
+			if err != nil {
+				return nil, retry.Unrecoverable(err)
+			}
+			req.Header.Set(header, value)
+			resp, err := client.Do(req)
+			if errors.Is(err, errEgressDenied) {
+				return nil, retry.Unrecoverable(err)
+			}
+			if err != nil {
+				return nil, err
+			}
+			defer func() {
+				if err := resp.Body.Close(); err != nil {
+					logFrom(ctx).Warn("Failed to close response body", "error", err)
+				}
+			}()
+			if resp.StatusCode != http.StatusOK {
+				err := fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+				if resp.StatusCode < http.StatusInternalServerError {
+					return nil, retry.Unrecoverable(err)
+				}
+				return nil, err
+			}
+			return io.ReadAll(io.LimitReader(resp.Body, maxSecretResponse))
+		},
+		retry.Context(ctx),
+		retry.Attempts(secretFetchAttempts),
+		retry.Delay(secretFetchDelay),
+		retry.DelayType(retry.FixedDelay),
+		retry.LastErrorOnly(true),
+	)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// useFakeSecretManager serves a metadata server and a Secret Manager API over
+// TLS, returning the CA file that trusts the API. The API is addressed as
+// https://example.com, a name its certificate covers.
+func useFakeSecretManager(t *testing.T, secret string) (apiAddr, caFile string) {
+	t.Helper()
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			_, _ = io.WriteString(w, "r2r-prod") //nolint:errcheck // test server
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			_, _ = io.WriteString(w, `{"access_token":"ya29.test","expires_in":3599,"token_type":"Bearer"}`) //nolint:errcheck // test server
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(metadata.Close)
+
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/projects/r2r-prod/secrets/GITHUB_CLIENT_SECRET/versions/latest:access" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"name":"v1","payload":{"data":"`+base64.StdEncoding.EncodeToString([]byte(secret))+`"}}`) //nolint:errcheck // test server
+	}))
+	t.Cleanup(api.Close)
+
+	prevMetadata, prevAPI := metadataURL, secretManagerURL
+	t.Cleanup(func() { metadataURL, secretManagerURL = prevMetadata, prevAPI })
+	metadataURL, secretManagerURL = metadata.URL+"/computeMetadata/v1", "https://example.com/v1"
+	return api.Listener.Addr().String(), writeCAFile(t, api)
+}
+
+// newConnectProxy starts a CONNECT proxy that tunnels every request to addr
+// and records the requested targets.
+func newConnectProxy(t *testing.T, addr string) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var targets []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		targets = append(targets, r.Method+" "+r.Host)
+		mu.Unlock()
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", addr)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		client, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close() //nolint:errcheck,gosec // test proxy
+			return
+		}
+		go func() {
+			_, _ = io.Copy(upstream, client) //nolint:errcheck // test proxy
+			upstream.Close()                 //nolint:errcheck,gosec // test proxy
+		}()
+		_, _ = io.Copy(client, upstream) //nolint:errcheck // test proxy
+		client.Close()                   //nolint:errcheck,gosec // test proxy
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), targets...)
+	}
+}
+
+// TestFetchSecretUsesEgress verifies Secret Manager is reached through the
+// egress proxy with the egress CA bundle, while the metadata server is not
+// proxied.
+func TestFetchSecretUsesEgress(t *testing.T) {
+	apiAddr, caFile := useFakeSecretManager(t, "s3cret")
+	proxy, targets := newConnectProxy(t, apiAddr)
+	useEgress(t, proxy.URL, "", "", caFile, "")
+
+	secret, err := fetchSecret(t.Context(), "GITHUB_CLIENT_SECRET")
+	if err != nil || secret != "s3cret" {
+		t.Fatalf("fetchSecret() = %q, %v", secret, err)
+	}
+	if got := targets(); len(got) != 1 || got[0] != "CONNECT example.com:443" {
+		t.Errorf("proxy saw %v, want only the Secret Manager API", got)
+	}
+}
+
+// TestFetchSecretAllowlist verifies the allowlist covers the metadata server.
+func TestFetchSecretAllowlist(t *testing.T) {
+	_, caFile := useFakeSecretManager(t, "s3cret")
+	useEgress(t, "", "", "", caFile, "example.com")
+
+	var calls atomic.Int32
+	prevClient := metadataClient.Transport
+	t.Cleanup(func() { metadataClient.Transport = prevClient })
+	metadataClient.Transport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		return prevClient.RoundTrip(r)
+	})
+
+	if _, err := fetchSecret(t.Context(), "GITHUB_CLIENT_SECRET"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("fetchSecret() error = %v, want an egress denial", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("metadata server tried %d times, want 1 without retries", got)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Site-wide defaults for link previews.
+const (
+	shareSiteName     = "Ready To Review"
+	shareDefaultImage = "assets/army.png"
+)
+
+// shareMetaTemplate renders the per-route head tags. html/template escapes every
+// value for its attribute context, so usernames and org names cannot break out.
+var shareMetaTemplate = template.Must(template.New("share").Parse(`<title>{{.Title}}</title>
+        <meta name="description" content="{{.Description}}" />
+        <meta property="og:type" content="website" />
+        <meta property="og:site_name" content="{{.SiteName}}" />
+        <meta property="og:title" content="{{.Title}}" />
+        <meta property="og:description" content="{{.Description}}" />
+        <meta property="og:url" content="{{.URL}}" />
+        <meta property="og:image" content="{{.Image}}" />
+        <meta name="twitter:card" content="{{.Card}}" />
+        <meta name="twitter:title" content="{{.Title}}" />
+        <meta name="twitter:description" content="{{.Description}}" />
+        <meta name="twitter:image" content="{{.Image}}" />
+`))
+
+var (
+	// Tags in index.html that the rendered share tags replace.
+	indexTitlePattern       = regexp.MustCompile(`(?s)<title>.*?</title>\s*`)
+	indexDescriptionPattern = regexp.MustCompile(`(?s)<meta\s+name="description".*?/>\s*`)
+
+	// Paths understood by parseURL in assets/app.js.
+	userPathPattern      = regexp.MustCompile(`^/u/([^/]+)$`)
+	changelogPathPattern = regexp.MustCompile(`^/changelog/([^/]+)$`)
+)
+
+// Subdomains that are not workspaces (mirrors Workspace.currentWorkspace in assets/workspace.js).
+var reservedSubdomains = map[string]bool{
+	"www": true, "dash": true, "api": true, "login": true, "auth-callback": true, "auth": true,
+}
+
+// sharePreview is the link preview for a dashboard route.
+type sharePreview struct {
+	Title       string
+	Description string
+	SiteName    string
+	URL         string
+	Image       string
+	Card        string
+}
+
+// workspaceFromHost returns the org workspace for a request host, or "" for the base domain.
+func workspaceFromHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	sub, ok := strings.CutSuffix(host, "."+*baseDomain)
+	if !ok || strings.Contains(sub, ".") || reservedSubdomains[sub] || !isValidGitHubHandle(sub) {
+		return ""
+	}
+	return sub
+}
+
+// previewForPath builds the preview for a route, or returns false for paths the
+// frontend does not route.
+func previewForPath(path, workspace string) (sharePreview, bool) {
+	path = strings.TrimSuffix(path, "/")
+	scope := "your GitHub pull requests"
+	if workspace != "" {
+		scope = "pull requests in " + workspace
+	}
+
+	var p sharePreview
+	switch {
+	case path == "/changelog":
+		p.Title = "Changelog"
+		p.Description = "Recently merged " + scope + "."
+		if workspace != "" {
+			p.Title = workspace + " changelog"
+		}
+	case path == "/leaderboard":
+		p.Title = "Leaderboard"
+		p.Description = "Who is reviewing and shipping " + scope + "."
+		if workspace != "" {
+			p.Title = workspace + " leaderboard"
+		}
+	case path == "/stats":
+		p.Title = "Pull request stats"
+		p.Description = "Review latency and throughput for " + scope + "."
+		if workspace != "" {
+			p.Title = workspace + " pull request stats"
+		}
+	case path == "/robots":
+		p.Title = "Robot settings"
+		p.Description = "Automations that keep " + scope + " moving."
+	case path == "/notifications":
+		p.Title = "Notifications"
+		p.Description = "Notification settings for " + scope + "."
+	default:
+		if m := userPathPattern.FindStringSubmatch(path); m != nil && isValidGitHubHandle(m[1]) {
+			p.Title = m[1] + "'s pull requests"
+			p.Description = "Pull requests waiting on " + m[1] + " for review, merge or follow-up."
+			if workspace != "" {
+				p.Description = "Pull requests in " + workspace + " waiting on " + m[1] + " for review, merge or follow-up."
+			}
+			p.Image = "https://github.com/" + m[1] + ".png?size=400"
+			break
+		}
+		if m := changelogPathPattern.FindStringSubmatch(path); m != nil && isValidGitHubHandle(m[1]) {
+			p.Title = m[1] + "'s changelog"
+			p.Description = "Pull requests recently merged by " + m[1] + "."
+			if workspace != "" {
+				p.Description = "Pull requests recently merged by " + m[1] + " in " + workspace + "."
+			}
+			p.Image = "https://github.com/" + m[1] + ".png?size=400"
+			break
+		}
+		return sharePreview{}, false
+	}
+
+	origin := workspaceOrigin(workspace)
+	p.Title += " · " + shareSiteName
+	p.SiteName = shareSiteName
+	p.URL = origin + path
+	p.Card = "summary"
+	if p.Image == "" {
+		if workspace != "" {
+			p.Image = "https://github.com/" + workspace + ".png?size=400"
+		} else {
+			p.Image = "https://" + *baseDomain + staticAssets.Load().url(shareDefaultImage)
+			p.Card = "summary_large_image"
+		}
+	}
+	return p, true
+}
+
+// renderSharePage injects the preview tags into index.html, replacing its generic
+// title and description.
+func renderSharePage(index []byte, p sharePreview) ([]byte, error) {
+	var meta bytes.Buffer
+	if err := shareMetaTemplate.Execute(&meta, p); err != nil {
+		return nil, err
+	}
+	page := indexTitlePattern.ReplaceAll(index, nil)
+	page = indexDescriptionPattern.ReplaceAllLiteral(page, nil)
+	return bytes.Replace(page, []byte("</head>"), append(meta.Bytes(), []byte("    </head>")...), 1), nil
+}
+
+// serveSharePage serves index.html with link preview tags for routes the frontend
+// understands. It returns false if the path has no preview.
+func serveSharePage(w http.ResponseWriter, r *http.Request, assets *assetStore, index *staticAsset) bool {
+	workspace, route := requestWorkspace(r)
+	p, ok := previewForPath(route, workspace)
+	if !ok {
+		return false
+	}
+
+	page, err := renderSharePage(index.data, p)
+	if err != nil {
+		logFrom(r.Context()).Error("Failed to render share preview", "path", r.URL.Path, "error", err)
+		return false
+	}
+
+	sum := sha256.Sum256(page)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "X-Original-Host")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, "index.html", assets.modTime, bytes.NewReader(page))
+	return true
+}
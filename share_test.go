@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSharePreviews verifies per-route Open Graph and Twitter tags.
+func TestSharePreviews(t *testing.T) {
+	setupStaticAssets(t)
+
+	tests := []struct {
+		path  string
+		host  string
+		want  []string
+		avoid []string
+	}{
+		{
+			path: "/u/alice",
+			host: "ready-to-review.dev",
+			want: []string{
+				`<meta property="og:title" content="alice&#39;s pull requests · Ready To Review" />`,
+				`<meta property="og:url" content="https://ready-to-review.dev/u/alice" />`,
+				`<meta name="twitter:image" content="https://github.com/alice.png?size=400" />`,
+			},
+		},
+		{
+			path: "/changelog/bob",
+			host: "acme.ready-to-review.dev",
+			want: []string{
+				`<title>bob&#39;s changelog · Ready To Review</title>`,
+				`content="Pull requests recently merged by bob in acme."`,
+				`<meta property="og:url" content="https://acme.ready-to-review.dev/changelog/bob" />`,
+			},
+		},
+		{
+			path: "/leaderboard",
+			host: "acme.ready-to-review.dev:443",
+			want: []string{
+				`<meta name="twitter:title" content="acme leaderboard · Ready To Review" />`,
+				`<meta property="og:image" content="https://github.com/acme.png?size=400" />`,
+			},
+		},
+		{
+			path: "/stats",
+			host: "evil.example.com",
+			want: []string{
+				`<meta property="og:url" content="https://ready-to-review.dev/stats" />`,
+				`<meta name="twitter:card" content="summary_large_image" />`,
+			},
+			avoid: []string{"evil.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, http.NoBody)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			serveStaticFiles(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			body := rec.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("response missing %s", want)
+				}
+			}
+			for _, avoid := range tt.avoid {
+				if strings.Contains(body, avoid) {
+					t.Errorf("response contains %s", avoid)
+				}
+			}
+			if n := strings.Count(body, "<title>"); n != 1 {
+				t.Errorf("response has %d <title> tags, want 1", n)
+			}
+			if n := strings.Count(body, `name="description"`); n != 1 {
+				t.Errorf("response has %d description tags, want 1", n)
+			}
+		})
+	}
+}
+
+// TestSharePreviewFallback verifies unknown routes and invalid handles get the generic shell.
+func TestSharePreviewFallback(t *testing.T) {
+	setupStaticAssets(t)
+	index := string(staticAssets.Load().assets["index.html"].data)
+
+	for _, path := range []string{"/some/other/page", "/u/%3Cscript%3E", "/u/-bad-"} {
+		rec := httptest.NewRecorder()
+		serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, path, http.NoBody))
+		if rec.Body.String() != index {
+			t.Errorf("GET %s did not serve the generic index.html", path)
+		}
+	}
+}
+
+// TestRenderSharePageEscapes verifies values are escaped for their HTML context.
+func TestRenderSharePageEscapes(t *testing.T) {
+	page, err := renderSharePage([]byte("<head><title>x</title></head>"), sharePreview{
+		Title:       `"><script>alert(1)</script>`,
+		Description: `a & b`,
+	})
+	if err != nil {
+		t.Fatalf("renderSharePage() error = %v", err)
+	}
+	got := string(page)
+	if strings.Contains(got, "<script>") {
+		t.Errorf("rendered page contains unescaped markup: %s", got)
+	}
+	if !strings.Contains(got, "a &amp; b") {
+		t.Errorf("rendered page did not escape ampersand: %s", got)
+	}
+}
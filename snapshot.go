@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// snapshotVersion is bumped whenever the snapshot format changes; other
+	// versions are ignored at startup.
+	snapshotVersion = 1
+	// snapshotAAD binds the ciphertext to its purpose so an auth code sealed
+	// with the same key can never be mistaken for a snapshot.
+	snapshotAAD = "r2r state snapshot"
+)
+
+// stateSnapshot is the security state written on shutdown and restored at
+// startup. It holds GitHub tokens and is only ever stored encrypted.
+type stateSnapshot struct {
+	Taken          time.Time                   `json:"taken"`
+	AuthCodes      map[string]snapshotAuthCode `json:"auth_codes"`
+	RateLimits     map[string][]time.Time      `json:"rate_limits"`
+	FailedAttempts map[string][]time.Time      `json:"failed_attempts"`
+	Version        int                         `json:"version"`
+}
+
+// snapshotAuthCode is a pending auth code. The token is unsealed so the next
+// process can seal it with its own auth code key.
+type snapshotAuthCode struct {
+	Expiry   time.Time `json:"expiry"`
+	Username string    `json:"username"`
+	ReturnTo string    `json:"return_to,omitempty"`
+	Token    []byte    `json:"token"`
+}
+
+// wipe zeroes the tokens in the snapshot.
+func (s *stateSnapshot) wipe() {
+	for _, c := range s.AuthCodes {
+		wipe(c.Token)
+	}
+}
+
+// snapshotSummary describes a snapshot for logs, without any secrets.
+func (s *stateSnapshot) summary() []any {
+	return []any{"auth_codes", len(s.AuthCodes), "rate_limited_clients", len(s.RateLimits), "failed_attempt_clients", len(s.FailedAttempts)}
+}
+
+// loadSnapshotKey decodes --state-snapshot-key, a base64 AES-256 key.
+func loadSnapshotKey(value string) ([]byte, error) {
+	if value == "" {
+		return nil, errors.New("a key is required to encrypt the snapshot (generate one with: openssl rand -base64 32)")
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	if len(key) != authCodeKeySize {
+		wipe(key)
+		return nil, fmt.Errorf("key must be %d bytes of base64, got %d", authCodeKeySize, len(key))
+	}
+	return key, nil
+}
+
+// recentTimes returns the times after cutoff, or nil if there are none.
+func recentTimes(times []time.Time, cutoff time.Time) []time.Time {
+	var recent []time.Time
+	for _, t := range times {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// takeSnapshot copies the unexpired auth codes, rate limiter windows and
+// failed attempts. Used auth codes are left out so they cannot be redeemed
+// again after a restart.
+func takeSnapshot(now time.Time) (*stateSnapshot, error) {
+	s := &stateSnapshot{
+		Version:        snapshotVersion,
+		Taken:          now,
+		AuthCodes:      make(map[string]snapshotAuthCode),
+		RateLimits:     make(map[string][]time.Time),
+		FailedAttempts: make(map[string][]time.Time),
+	}
+
+	authCodesMutex.Lock()
+	for code, data := range authCodes {
+		if data.used || !now.Before(data.expiry) {
+			continue
+		}
+		token, err := authCodeSealer.open(data.sealedToken, code)
+		if err != nil {
+			authCodesMutex.Unlock()
+			s.wipe()
+			return nil, fmt.Errorf("open sealed token: %w", err)
+		}
+		s.AuthCodes[code] = snapshotAuthCode{Token: token, Username: data.username, ReturnTo: data.returnTo, Expiry: data.expiry}
+	}
+	authCodesMutex.Unlock()
+
+	exchangeRateLimiter.mu.Lock()
+	for ip, times := range exchangeRateLimiter.requests {
+		if recent := recentTimes(times, now.Add(-exchangeRateLimiter.window)); recent != nil {
+			s.RateLimits[ip] = recent
+		}
+	}
+	exchangeRateLimiter.mu.Unlock()
+
+	failedMutex.Lock()
+	for ip, times := range failedAttempts {
+		if recent := recentTimes(times, now.Add(-*failedLoginWindow)); recent != nil {
+			s.FailedAttempts[ip] = recent
+		}
+	}
+	failedMutex.Unlock()
+	return s, nil
+}
+
+// applySnapshot merges a snapshot into the current state, dropping auth codes
+// that have expired and events that are outside their windows by now.
+func applySnapshot(s *stateSnapshot, now time.Time) error {
+	authCodesMutex.Lock()
+	defer authCodesMutex.Unlock()
+	for code, c := range s.AuthCodes {
+		if !now.Before(c.Expiry) {
+			continue
+		}
+		sealed, err := authCodeSealer.seal(c.Token, code)
+		if err != nil {
+			return fmt.Errorf("seal restored token: %w", err)
+		}
+		authCodes[code] = authCodeData{sealedToken: sealed, username: c.Username, returnTo: c.ReturnTo, expiry: c.Expiry}
+	}
+
+	exchangeRateLimiter.mu.Lock()
+	for ip, times := range s.RateLimits {
+		if recent := recentTimes(times, now.Add(-exchangeRateLimiter.window)); recent != nil {
+			exchangeRateLimiter.requests[ip] = append(exchangeRateLimiter.requests[ip], recent...)
+		}
+	}
+	exchangeRateLimiter.mu.Unlock()
+
+	failedMutex.Lock()
+	for ip, times := range s.FailedAttempts {
+		if recent := recentTimes(times, now.Add(-*failedLoginWindow)); recent != nil {
+			failedAttempts[ip] = append(failedAttempts[ip], recent...)
+		}
+	}
+	failedMutex.Unlock()
+	return nil
+}
+
+// saveSnapshot encrypts the current state with sealer and writes it to path,
+// replacing any previous snapshot atomically.
+func saveSnapshot(path string, sealer *tokenSealer, now time.Time) error {
+	s, err := takeSnapshot(now)
+	if err != nil {
+		return err
+	}
+	defer s.wipe()
+	plaintext, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	defer wipe(plaintext)
+	sealed, err := sealer.seal(plaintext, snapshotAAD)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // already renamed on success
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close() //nolint:errcheck,gosec // reporting the write error
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	slog.Info("Saved security state snapshot", append([]any{"path", path}, s.summary()...)...)
+	return nil
+}
+
+// restoreSnapshot loads the snapshot at path, if there is one, and deletes it
+// so the same auth codes are never restored twice.
+func restoreSnapshot(path string, sealer *tokenSealer, now time.Time) error {
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove snapshot: %w", err)
+	}
+
+	plaintext, err := sealer.open(sealed, snapshotAAD)
+	if err != nil {
+		return fmt.Errorf("decrypt snapshot (was --state-snapshot-key changed?): %w", err)
+	}
+	defer wipe(plaintext)
+	var s stateSnapshot
+	if err := json.Unmarshal(plaintext, &s); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	defer s.wipe()
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("snapshot version %d is not supported, want %d", s.Version, snapshotVersion)
+	}
+	if err := applySnapshot(&s, now); err != nil {
+		return err
+	}
+	slog.Info("Restored security state snapshot", append([]any{"path", path, "taken", s.Taken}, s.summary()...)...)
+	return nil
+}
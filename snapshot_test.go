@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSnapshotSealer returns a sealer with a fresh snapshot key.
+func newSnapshotSealer(t *testing.T) *tokenSealer {
+	t.Helper()
+	key, err := loadSnapshotKey(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, authCodeKeySize)))
+	if err != nil {
+		t.Fatalf("loadSnapshotKey() error = %v", err)
+	}
+	sealer, err := newTokenSealer(key)
+	if err != nil {
+		t.Fatalf("newTokenSealer() error = %v", err)
+	}
+	return sealer
+}
+
+// simulateRestart clears the security state and replaces the auth code key,
+// as a new process would.
+func simulateRestart(t *testing.T) {
+	t.Helper()
+	setupAuthCodeStore(t)
+	exchangeRateLimiter = &rateLimiter{requests: make(map[string][]time.Time), limit: *rateLimitRequests, window: *rateLimitWindow}
+	failedMutex.Lock()
+	failedAttempts = make(map[string][]time.Time)
+	failedMutex.Unlock()
+}
+
+// TestSnapshotSurvivesRestart saves state on shutdown, restores it in a
+// simulated new process and redeems an auth code issued before the restart.
+func TestSnapshotSurvivesRestart(t *testing.T) {
+	simulateRestart(t)
+	sealer := newSnapshotSealer(t)
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	now := time.Now()
+
+	pending := generateID(32)
+	if err := storeAuthCode(pending, testToken, "alice", "https://acme.example.test/", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	expired := generateID(32)
+	if err := storeAuthCode(expired, testToken, "bob", "", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	used := generateID(32)
+	if err := storeAuthCode(used, testToken, "carol", "", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	authCodesMutex.Lock()
+	data := authCodes[used]
+	data.used = true
+	authCodes[used] = data
+	authCodesMutex.Unlock()
+	exchangeRateLimiter.requests["192.0.2.1"] = []time.Time{now.Add(-time.Hour), now.Add(-time.Second)}
+	exchangeRateLimiter.requests["192.0.2.2"] = []time.Time{now.Add(-time.Hour)}
+	failedAttempts["192.0.2.3"] = []time.Time{now.Add(-time.Minute)}
+	time.Sleep(2 * time.Millisecond)
+
+	if err := saveSnapshot(path, sealer, time.Now()); err != nil {
+		t.Fatalf("saveSnapshot() error = %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{testToken, "alice", pending} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Errorf("snapshot file contains %q in plaintext", secret)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("snapshot mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+
+	simulateRestart(t)
+	if err := restoreSnapshot(path, sealer, time.Now()); err != nil {
+		t.Fatalf("restoreSnapshot() error = %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("snapshot still on disk after restore (%v); its codes could be restored twice", err)
+	}
+
+	authCodesMutex.Lock()
+	_, hasExpired := authCodes[expired]
+	_, hasUsed := authCodes[used]
+	restoredCodes := len(authCodes)
+	authCodesMutex.Unlock()
+	if restoredCodes != 1 || hasExpired || hasUsed {
+		t.Errorf("restored %d auth codes (expired %v, used %v), want only the pending one", restoredCodes, hasExpired, hasUsed)
+	}
+	if got := len(exchangeRateLimiter.requests["192.0.2.1"]); got != 1 {
+		t.Errorf("restored %d rate limited requests for 192.0.2.1, want the 1 inside the window", got)
+	}
+	if _, ok := exchangeRateLimiter.requests["192.0.2.2"]; ok {
+		t.Error("restored a client whose requests are all outside the window")
+	}
+	if got := len(failedAttempts["192.0.2.3"]); got != 1 {
+		t.Errorf("restored %d failed attempts, want 1", got)
+	}
+
+	// The code issued before the restart can be redeemed once
+	req := httptest.NewRequest(http.MethodPost, "/oauth/exchange", strings.NewReader(`{"auth_code":"`+pending+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handleExchangeAuthCode(rec, req)
+	var resp struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("exchange after restart: status = %d, error = %v", rec.Code, err)
+	}
+	if resp.Token != testToken || resp.Username != "alice" {
+		t.Errorf("exchange after restart = %+v, want alice's token", resp)
+	}
+}
+
+// TestSnapshotRejectsWrongKey verifies a snapshot cannot be read or forged
+// without the key.
+func TestSnapshotRejectsWrongKey(t *testing.T) {
+	simulateRestart(t)
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	if err := storeAuthCode(generateID(32), testToken, "alice", "", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveSnapshot(path, newSnapshotSealer(t), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, authCodeKeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	other, err := newTokenSealer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulateRestart(t)
+	if err := restoreSnapshot(path, other, time.Now()); err == nil {
+		t.Error("restoreSnapshot() succeeded with the wrong key")
+	}
+	authCodesMutex.Lock()
+	defer authCodesMutex.Unlock()
+	if len(authCodes) != 0 {
+		t.Errorf("restored %d auth codes from an unreadable snapshot", len(authCodes))
+	}
+}
+
+// TestRestoreWithoutSnapshot verifies a first start has nothing to restore.
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	simulateRestart(t)
+	if err := restoreSnapshot(filepath.Join(t.TempDir(), "missing"), newSnapshotSealer(t), time.Now()); err != nil {
+		t.Errorf("restoreSnapshot() error = %v for a missing file", err)
+	}
+}
+
+func TestLoadSnapshotKey(t *testing.T) {
+	for _, value := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := loadSnapshotKey(value); err == nil {
+			t.Errorf("loadSnapshotKey(%q) succeeded", value)
+		}
+	}
+}
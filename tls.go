@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS modes for --tls. Off leaves TLS to a fronting proxy such as Cloud Run.
+const (
+	tlsModeOff   = "off"
+	tlsModeFiles = "files"
+	tlsModeACME  = "acme"
+)
+
+const (
+	// certPollInterval is how often certificate files are checked for changes.
+	certPollInterval = 10 * time.Second
+	// acmeRenewBefore renews ACME certificates this long before they expire.
+	acmeRenewBefore = 30 * 24 * time.Hour
+	// acmeCheckInterval is how often the wildcard certificate is checked for renewal.
+	acmeCheckInterval = 12 * time.Hour
+	// acmeRetryInterval is the wait after a failed wildcard issuance.
+	acmeRetryInterval = 15 * time.Minute
+	// acmeChallengePrefix is where HTTP-01 challenges are answered.
+	acmeChallengePrefix = "/.well-known/acme-challenge/"
+	// acmeAccountKeyName and the wildcard certificate live in the ACME cache
+	// directory alongside autocert's entries.
+	acmeAccountKeyName = "acme_account+key"
+)
+
+func validateTLSMode(mode string) error {
+	switch mode {
+	case tlsModeOff, tlsModeFiles, tlsModeACME:
+		return nil
+	default:
+		return fmt.Errorf("%q is not one of %s, %s or %s", mode, tlsModeOff, tlsModeFiles, tlsModeACME)
+	}
+}
+
+// certReloader serves a certificate from files, picking up replacements (for
+// example from certbot) without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	cert      atomic.Pointer[tls.Certificate]
+	signature atomic.Value // string
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fileSignature changes whenever either file is replaced or rewritten.
+func (c *certReloader) fileSignature() (string, error) {
+	var sig strings.Builder
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sig, "%s\x00%d\x00%d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+	return sig.String(), nil
+}
+
+// reload loads the key pair if the files changed, reporting whether it did.
+// The previous certificate stays in use if the new files are invalid.
+func (c *certReloader) reload() (bool, error) {
+	sig, err := c.fileSignature()
+	if err != nil {
+		return false, err
+	}
+	if prev, _ := c.signature.Load().(string); prev == sig {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load certificate: %w", err)
+	}
+	c.cert.Store(&cert)
+	c.signature.Store(sig)
+	return true, nil
+}
+
+// watch polls the certificate files until ctx is done.
+func (c *certReloader) watch(ctx context.Context) {
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := c.reload()
+		if err != nil {
+			slog.Error("Failed to reload TLS certificate, keeping previous one", "cert", c.certFile, "error", err)
+			continue
+		}
+		if changed {
+			slog.Info("Reloaded TLS certificate", "cert", c.certFile, "fingerprint", certFingerprint(c.cert.Load()))
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// dnsProvider publishes the TXT records that prove control of a domain for
+// ACME DNS-01 challenges, which wildcard certificates require. Present must
+// return once the record is visible to public resolvers. Several values may be
+// presented for the same name at once.
+type dnsProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// execDNSHook is a dnsProvider that runs an external program:
+//
+//	<hook> present _acme-challenge.example.com <value>
+//	<hook> cleanup _acme-challenge.example.com <value>
+type execDNSHook struct {
+	path string
+}
+
+func (h execDNSHook) Present(ctx context.Context, fqdn, value string) error {
+	return h.run(ctx, "present", fqdn, value)
+}
+
+func (h execDNSHook) CleanUp(ctx context.Context, fqdn, value string) error {
+	return h.run(ctx, "cleanup", fqdn, value)
+}
+
+func (h execDNSHook) run(ctx context.Context, action, fqdn, value string) error {
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.path, action, fqdn, value)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("DNS hook %s %s: %w: %s", action, fqdn, err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// wildcardManager obtains and renews a certificate for the base domain and
+// *.base domain through ACME DNS-01 challenges, so workspaces need no
+// per-subdomain certificates.
+type wildcardManager struct {
+	domain   string
+	email    string
+	client   *acme.Client
+	cache    autocert.Cache
+	provider dnsProvider
+
+	cert atomic.Pointer[tls.Certificate]
+}
+
+func (m *wildcardManager) cacheKey() string {
+	return "wildcard+" + m.domain
+}
+
+// covers reports whether the wildcard certificate serves host.
+func (m *wildcardManager) covers(host string) bool {
+	if host == m.domain {
+		return true
+	}
+	sub, ok := strings.CutSuffix(host, "."+m.domain)
+	return ok && sub != "" && !strings.Contains(sub, ".")
+}
+
+func (m *wildcardManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !m.covers(strings.ToLower(hello.ServerName)) {
+		return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+	}
+	cert := m.cert.Load()
+	if cert == nil {
+		return nil, errors.New("wildcard certificate not issued yet")
+	}
+	return cert, nil
+}
+
+// needsRenewal reports whether there is no usable certificate or it expires soon.
+func (m *wildcardManager) needsRenewal(now time.Time) bool {
+	cert := m.cert.Load()
+	return cert == nil || cert.Leaf == nil || cert.Leaf.NotAfter.Sub(now) < acmeRenewBefore
+}
+
+// loadCached restores a previously issued certificate from the cache.
+func (m *wildcardManager) loadCached(ctx context.Context) error {
+	data, err := m.cache.Get(ctx, m.cacheKey())
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return fmt.Errorf("cached certificate: %w", err)
+	}
+	if len(cert.Certificate) == 0 || cert.Leaf == nil {
+		return errors.New("cached certificate is empty")
+	}
+	m.cert.Store(&cert)
+	return nil
+}
+
+// run keeps the certificate fresh until ctx is done.
+func (m *wildcardManager) run(ctx context.Context) {
+	for {
+		wait := acmeCheckInterval
+		if m.needsRenewal(time.Now()) {
+			if err := m.obtain(ctx); err != nil {
+				slog.Error("Failed to obtain wildcard certificate", "domain", m.domain, "error", err)
+				wait = acmeRetryInterval
+			} else {
+				slog.Info("Obtained wildcard certificate", "domain", m.domain, "expires", m.cert.Load().Leaf.NotAfter)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// obtain runs an ACME order for the base and wildcard names.
+func (m *wildcardManager) obtain(ctx context.Context) error {
+	if err := m.register(ctx); err != nil {
+		return err
+	}
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.domain, "*."+m.domain))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+
+	// The base and wildcard names share one TXT record name, so present every
+	// value before asking the CA to check any of them.
+	type pending struct {
+		authz *acme.Authorization
+		chal  *acme.Challenge
+		fqdn  string
+		value string
+	}
+	var challenges []pending
+	defer func() {
+		for _, p := range challenges {
+			if err := m.provider.CleanUp(context.WithoutCancel(ctx), p.fqdn, p.value); err != nil {
+				slog.Warn("Failed to clean up DNS challenge", "fqdn", p.fqdn, "error", err)
+			}
+		}
+	}()
+	for _, url := range order.AuthzURLs {
+		authz, err := m.client.GetAuthorization(ctx, url)
+		if err != nil {
+			return fmt.Errorf("get authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+		var chal *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "dns-01" {
+				chal = c
+			}
+		}
+		if chal == nil {
+			return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+		}
+		value, err := m.client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return err
+		}
+		fqdn := "_acme-challenge." + authz.Identifier.Value
+		if err := m.provider.Present(ctx, fqdn, value); err != nil {
+			return err
+		}
+		challenges = append(challenges, pending{authz: authz, chal: chal, fqdn: fqdn, value: value})
+	}
+	for _, p := range challenges {
+		if _, err := m.client.Accept(ctx, p.chal); err != nil {
+			return fmt.Errorf("accept challenge for %s: %w", p.authz.Identifier.Value, err)
+		}
+	}
+	for _, p := range challenges {
+		if _, err := m.client.WaitAuthorization(ctx, p.authz.URI); err != nil {
+			return fmt.Errorf("authorization for %s: %w", p.authz.Identifier.Value, err)
+		}
+	}
+	if order, err = m.client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("wait for order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{m.domain, "*." + m.domain},
+	}, key)
+	if err != nil {
+		return err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+
+	data, err := encodeCertificate(key, chain)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return fmt.Errorf("issued certificate: %w", err)
+	}
+	if err := m.cache.Put(ctx, m.cacheKey(), data); err != nil {
+		slog.Warn("Failed to cache wildcard certificate", "error", err)
+	}
+	m.cert.Store(&cert)
+	return nil
+}
+
+// register creates the ACME account, reusing the cached account key.
+func (m *wildcardManager) register(ctx context.Context) error {
+	if m.client.Key == nil {
+		key, err := loadOrCreateAccountKey(ctx, m.cache)
+		if err != nil {
+			return err
+		}
+		m.client.Key = key
+	}
+	account := &acme.Account{}
+	if m.email != "" {
+		account.Contact = []string{"mailto:" + m.email}
+	}
+	if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("register ACME account: %w", err)
+	}
+	return nil
+}
+
+func loadOrCreateAccountKey(ctx context.Context, cache autocert.Cache) (crypto.Signer, error) {
+	data, err := cache.Get(ctx, acmeAccountKeyName)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("cached ACME account key is not PEM")
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, autocert.ErrCacheMiss) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := cache.Put(ctx, acmeAccountKeyName, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// encodeCertificate stores a private key and its chain as one PEM bundle.
+func encodeCertificate(key *ecdsa.PrivateKey, chain [][]byte) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, err
+	}
+	for _, c := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c}); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// acmeHostPolicy allows HTTP-01 certificates only for the base domain and the
+// auth host. Workspace subdomains are covered by the wildcard certificate;
+// issuing per subdomain would let anyone spend our Let's Encrypt rate limits
+// by connecting with made-up names.
+func acmeHostPolicy(_ context.Context, host string) error {
+	if host == *baseDomain || host == authHost() {
+		return nil
+	}
+	return fmt.Errorf("host %q not allowed", host)
+}
+
+// tlsSetup is the TLS configuration for the main listener plus the handler for
+// the companion HTTP listener.
+type tlsSetup struct {
+	config   *tls.Config
+	redirect http.Handler
+	start    func(context.Context)
+}
+
+// newTLSSetup configures certificates for the --tls mode.
+func newTLSSetup(ctx context.Context) (*tlsSetup, error) {
+	switch *tlsMode {
+	case tlsModeFiles:
+		reloader, err := newCertReloader(*tlsCertFile, *tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &tlsSetup{
+			config:   &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.getCertificate},
+			redirect: httpsRedirect(nil),
+			start:    reloader.watch,
+		}, nil
+
+	case tlsModeACME:
+		cache := autocert.DirCache(*acmeCacheDir)
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      cache,
+			HostPolicy: acmeHostPolicy,
+			Email:      *acmeEmail,
+			Client:     &acme.Client{DirectoryURL: *acmeDirectory, HTTPClient: &http.Client{Transport: outboundTransport}},
+		}
+		config := manager.TLSConfig()
+		config.MinVersion = tls.VersionTLS12
+		setup := &tlsSetup{config: config, redirect: httpsRedirect(manager.HTTPHandler(nil)), start: func(context.Context) {}}
+		if *acmeDNSHook == "" {
+			return setup, nil
+		}
+
+		// Wildcards need DNS-01; autocert covers the base domain and auth host
+		// until the wildcard certificate is issued
+		wildcard := &wildcardManager{
+			domain:   *baseDomain,
+			email:    *acmeEmail,
+			client:   &acme.Client{DirectoryURL: *acmeDirectory, HTTPClient: &http.Client{Transport: outboundTransport}},
+			cache:    cache,
+			provider: execDNSHook{path: *acmeDNSHook},
+		}
+		if err := wildcard.loadCached(ctx); err != nil && !errors.Is(err, autocert.ErrCacheMiss) {
+			slog.Warn("Ignoring cached wildcard certificate", "error", err)
+		}
+		config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if wildcard.covers(strings.ToLower(hello.ServerName)) && wildcard.cert.Load() != nil {
+				return wildcard.getCertificate(hello)
+			}
+			return manager.GetCertificate(hello)
+		}
+		setup.start = wildcard.run
+		return setup, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// httpsRedirect answers ACME HTTP-01 challenges (when challenges is non-nil) and
+// permanently redirects everything else on our hosts to HTTPS.
+func httpsRedirect(challenges http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if challenges != nil && strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+			challenges.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !isOurHost(host) && !isLocalhost(host) {
+			http.NotFound(w, r)
+			return
+		}
+		if *port != "443" {
+			host = net.JoinHostPort(host, *port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		w.Header().Set("Connection", "close")
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
+
+// httpProtocols enables HTTP/1.1 and HTTP/2 on the TLS listener.
+func httpProtocols() *http.Protocols {
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	return &p
+}
+
+// certFingerprint identifies a certificate in logs.
+func certFingerprint(cert *tls.Certificate) string {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return fmt.Sprintf("%x", sum[:8])
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTestCertificate returns a self-signed certificate for names.
+func newTestCertificate(t *testing.T, names []string, validFor time.Duration) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, der
+}
+
+// writeTestCertificate writes a certificate and key for names to PEM files,
+// dated at modTime so rewrites are always noticed.
+func writeTestCertificate(t *testing.T, dir string, names []string, modTime time.Time) (certFile, keyFile string, der []byte) {
+	t.Helper()
+	key, der := newTestCertificate(t, names, 90*24*time.Hour)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for name, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile, der
+}
+
+// TestCertReloader verifies replaced certificate files are picked up and broken
+// replacements keep the previous certificate.
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile, first := writeTestCertificate(t, dir, []string{"example.test"}, now)
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	served := func() []byte {
+		cert, err := reloader.getCertificate(&tls.ClientHelloInfo{ServerName: "example.test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Certificate[0]
+	}
+	if string(served()) != string(first) {
+		t.Fatal("reloader does not serve the initial certificate")
+	}
+
+	if changed, err := reloader.reload(); changed || err != nil {
+		t.Errorf("reload() without changes = %v, %v; want false, nil", changed, err)
+	}
+
+	_, _, second := writeTestCertificate(t, dir, []string{"example.test"}, now.Add(time.Minute))
+	if changed, err := reloader.reload(); !changed || err != nil {
+		t.Fatalf("reload() after rewrite = %v, %v; want true, nil", changed, err)
+	}
+	if string(served()) != string(second) {
+		t.Error("reloader still serves the old certificate")
+	}
+
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reloader.reload(); err == nil {
+		t.Error("reload() of a broken key succeeded")
+	}
+	if string(served()) != string(second) {
+		t.Error("broken files replaced the working certificate")
+	}
+}
+
+// TestTLSServesHTTP2 verifies the TLS listener negotiates HTTP/2.
+func TestTLSServesHTTP2(t *testing.T) {
+	certFile, keyFile, der := writeTestCertificate(t, t.TempDir(), []string{"localhost"}, time.Now())
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Proto)) //nolint:errcheck // test server
+		}),
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: reloader.getCertificate},
+		Protocols:         httpProtocols(),
+		ReadHeaderTimeout: time.Second,
+	}
+	go srv.ServeTLS(ln, "", "")           //nolint:errcheck // closed below
+	t.Cleanup(func() { _ = srv.Close() }) //nolint:errcheck // test cleanup
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // test
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+}
+
+// TestHTTPSRedirect verifies the HTTP listener redirects our hosts and hands
+// ACME challenges to the certificate manager.
+func TestHTTPSRedirect(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	prevPort := *port
+	t.Cleanup(func() { *port = prevPort })
+
+	challenges := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("challenge-response")) //nolint:errcheck // test handler
+	})
+	handler := httpsRedirect(challenges)
+
+	tests := []struct {
+		port   string
+		target string
+		code   int
+		want   string
+	}{
+		{port: "443", target: "http://acme.example.test/pulls?state=open", code: http.StatusPermanentRedirect, want: "https://acme.example.test/pulls?state=open"},
+		{port: "8443", target: "http://example.test:8080/", code: http.StatusPermanentRedirect, want: "https://example.test:8443/"},
+		{port: "443", target: "http://evil.test/", code: http.StatusNotFound},
+		{port: "443", target: "http://acme.example.test" + acmeChallengePrefix + "token", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		*port = tt.port
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, http.NoBody))
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s = %d %q, want %d %q", tt.target, rec.Code, rec.Header().Get("Location"), tt.code, tt.want)
+		}
+	}
+}
+
+// TestExecDNSHook verifies the hook program receives the challenge record.
+func TestExecDNSHook(t *testing.T) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "calls")
+	hook := filepath.Join(dir, "hook.sh")
+	script := "#!/bin/sh\nif [ \"$3\" = fail ]; then echo 'zone not found' >&2; exit 1; fi\necho \"$@\" >> " + record + "\n"
+	if err := os.WriteFile(hook, []byte(script), 0o700); err != nil { //nolint:gosec // test script must be executable
+		t.Fatal(err)
+	}
+
+	provider := execDNSHook{path: hook}
+	if err := provider.Present(t.Context(), "_acme-challenge.example.test", "abc"); err != nil {
+		t.Fatalf("Present() error = %v", err)
+	}
+	if err := provider.CleanUp(t.Context(), "_acme-challenge.example.test", "abc"); err != nil {
+		t.Fatalf("CleanUp() error = %v", err)
+	}
+	calls, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "present _acme-challenge.example.test abc\ncleanup _acme-challenge.example.test abc\n"
+	if string(calls) != want {
+		t.Errorf("hook calls = %q, want %q", calls, want)
+	}
+
+	err = provider.Present(t.Context(), "_acme-challenge.example.test", "fail")
+	if err == nil || !strings.Contains(err.Error(), "zone not found") {
+		t.Errorf("Present() error = %v, want the hook's output", err)
+	}
+}
+
+// TestWildcardCertificate verifies a cached wildcard certificate serves the base
+// domain and single-level subdomains, and is renewed before it expires.
+func TestWildcardCertificate(t *testing.T) {
+	cache := autocert.DirCache(t.TempDir())
+	manager := &wildcardManager{domain: "example.test", cache: cache}
+
+	if !manager.needsRenewal(time.Now()) {
+		t.Error("needsRenewal() = false without a certificate")
+	}
+	key, der := newTestCertificate(t, []string{"example.test", "*.example.test"}, 60*24*time.Hour)
+	data, err := encodeCertificate(key, [][]byte{der})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(t.Context(), manager.cacheKey(), data); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.loadCached(t.Context()); err != nil {
+		t.Fatalf("loadCached() error = %v", err)
+	}
+
+	for host, want := range map[string]bool{
+		"example.test":        true,
+		"acme.example.test":   true,
+		"a.acme.example.test": false,
+		"example.test.evil":   false,
+	} {
+		_, err := manager.getCertificate(&tls.ClientHelloInfo{ServerName: host})
+		if (err == nil) != want {
+			t.Errorf("getCertificate(%s) error = %v, want served = %v", host, err, want)
+		}
+	}
+	if manager.needsRenewal(time.Now()) {
+		t.Error("needsRenewal() = true for a certificate valid for 60 days")
+	}
+	if !manager.needsRenewal(time.Now().Add(40 * 24 * time.Hour)) {
+		t.Error("needsRenewal() = false 20 days before expiry")
+	}
+}
+
+// TestACMEHostPolicy verifies HTTP-01 certificates are only issued for our
+// fixed hosts, never for arbitrary workspace subdomains.
+func TestACMEHostPolicy(t *testing.T) {
+	useBaseDomain(t, "example.test")
+	for host, want := range map[string]bool{
+		"example.test":      true,
+		authHost():          true,
+		"acme.example.test": false,
+		"evil.test":         false,
+	} {
+		if err := acmeHostPolicy(t.Context(), host); (err == nil) != want {
+			t.Errorf("acmeHostPolicy(%s) error = %v, want allowed = %v", host, err, want)
+		}
+	}
+}
+
+// TestACMERequiresDNSHook verifies --tls=acme with subdomain workspaces needs
+// the wildcard certificate.
+func TestACMERequiresDNSHook(t *testing.T) {
+	prevMode, prevHook, prevWorkspaces := *tlsMode, *acmeDNSHook, *workspaceMode
+	t.Cleanup(func() { *tlsMode, *acmeDNSHook, *workspaceMode = prevMode, prevHook, prevWorkspaces })
+	*tlsMode, *acmeDNSHook = tlsModeACME, ""
+
+	*workspaceMode = workspaceModeSubdomain
+	if err := validateConfig(map[string]configSource{}); err == nil || !strings.Contains(err.Error(), "acme-dns-hook (from ") {
+		t.Errorf("validateConfig() error = %v, want --acme-dns-hook required", err)
+	}
+	*workspaceMode = workspaceModePath
+	if err := validateConfig(map[string]configSource{}); err != nil && strings.Contains(err.Error(), "acme-dns-hook (from ") {
+		t.Errorf("validateConfig() error = %v, want no --acme-dns-hook error in path mode", err)
+	}
+}
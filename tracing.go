@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "github.com/r2r/dashboard"
+	defaultServiceName = "r2r-dashboard"
+	requestIDAttribute = "http.request.header.x-request-id"
+)
+
+// tracingEnabled reports whether OTLP export is configured. Tracing is off
+// unless an OTLP endpoint is set, and OTEL_SDK_DISABLED or
+// OTEL_TRACES_EXPORTER=none turn it off again.
+func tracingEnabled(getenv func(string) string) bool {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") || getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// setupTracing installs an OTLP/HTTP trace exporter configured by the standard
+// OTEL_* environment variables. The returned function flushes pending spans.
+// Incoming W3C trace context is continued whether or not export is enabled.
+// Baggage is not propagated: it comes from callers we do not trust.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if !tracingEnabled(os.Getenv) {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// The exporter goes through the egress proxy and allowlist, and trusts the
+	// egress CA bundle on top of its own OTEL_EXPORTER_OTLP_CERTIFICATE
+	options := []otlptracehttp.Option{otlptracehttp.WithProxy(egressProxy)}
+	if egressRoots != nil {
+		roots, err := otlpRoots(egressRoots, os.Getenv)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, otlptracehttp.WithTLSClientConfig(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}))
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default name
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(defaultServiceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, errors.Join(err, exporter.Shutdown(ctx))
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// otlpRoots adds the certificate the exporter would otherwise trust on its own
+// to the egress roots, since a TLS config passed in code replaces it.
+func otlpRoots(egress *x509.CertPool, getenv func(string) string) (*x509.CertPool, error) {
+	path := getenv("OTEL_EXPORTER_OTLP_TRACES_CERTIFICATE")
+	if path == "" {
+		path = getenv("OTEL_EXPORTER_OTLP_CERTIFICATE")
+	}
+	if path == "" {
+		return egress, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("OTLP certificate: %w", err)
+	}
+	roots := egress.Clone()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("OTLP certificate: %s contains no PEM certificates", path)
+	}
+	return roots, nil
+}
+
+// tracer returns the server's tracer from the current global provider.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// traceRequests starts a server span for every request, continuing any trace
+// propagated by the caller. Spans are named after the mux pattern so names stay
+// bounded like metric labels.
+func traceRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routePattern(mux, r)
+		ctx, span := tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(clientIP(r)),
+			))
+		defer span.End()
+		if sc := span.SpanContext(); sc.IsValid() {
+			addLogAttrs(ctx, "trace_id", sc.TraceID().String())
+		}
+
+		wrapped, ok := w.(*responseWriter)
+		if !ok {
+			wrapped = &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		}
+		next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+		// securityHeaders assigns the request ID on the way in
+		span.SetAttributes(
+			attribute.String(requestIDAttribute, w.Header().Get("X-Request-ID")),
+			semconv.HTTPResponseStatusCode(wrapped.statusCode),
+		)
+		if wrapped.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(wrapped.statusCode))
+		}
+	})
+}
+
+// startGitHubCall starts the span covering a GitHub call and its retries. The
+// returned function ends it and records the call's latency metric.
+func startGitHubCall(ctx context.Context, call string) (context.Context, func(error)) {
+	ctx, span := tracer().Start(ctx, "github."+call, trace.WithAttributes(attribute.String("github.call", call)))
+	start := time.Now()
+	return ctx, func(err error) {
+		observeGitHubCall(call, start, err)
+		endSpan(span, err)
+	}
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useTestTracer records spans in memory for the rest of the test.
+func useTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// TestTraceRequests verifies server spans continue the caller's trace and carry the request ID.
+func TestTraceRequests(t *testing.T) {
+	exporter := useTestTracer(t)
+	mux := newMux(nil)
+	handler := traceRequests(mux, securityHeaders(mux))
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodGet, "/health", http.NoBody)
+	req.Header.Set("Traceparent", parent)
+	req.Header.Set("X-Request-ID", "req-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /health" || span.SpanKind != trace.SpanKindServer {
+		t.Errorf("span = %q kind %v, want server span GET /health", span.Name, span.SpanKind)
+	}
+	if got := span.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the propagated trace", got)
+	}
+	if got := spanAttribute(span, requestIDAttribute); got != "req-123" {
+		t.Errorf("request ID attribute = %q, want req-123", got)
+	}
+}
+
+// TestTraceGitHubAttempts verifies each retry attempt gets its own span under the
+// call span and that neither trace context nor the caller's baggage reaches GitHub.
+func TestTraceGitHubAttempts(t *testing.T) {
+	exporter := useTestTracer(t)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	member, err := baggage.NewMember("tenant", "internal-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(member)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := baggage.ContextWithBaggage(t.Context(), bag)
+
+	failures := 1
+	var leaked []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{"Traceparent", "Tracestate", "Baggage"} {
+			if v := r.Header.Get(name); v != "" {
+				leaked = append(leaked, name+": "+v)
+			}
+		}
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"login":"alice","id":1}`)) //nolint:errcheck // test server
+	}))
+	t.Cleanup(srv.Close)
+	prevAPI := githubAPIURL
+	t.Cleanup(func() { githubAPIURL = prevAPI })
+	githubAPIURL = srv.URL
+
+	if _, err := userInfo(ctx, testToken); err != nil {
+		t.Fatalf("userInfo() error = %v", err)
+	}
+
+	var call tracetest.SpanStub
+	var attempts []tracetest.SpanStub
+	for _, span := range exporter.GetSpans() {
+		switch span.Name {
+		case "github." + githubCallUserInfo:
+			call = span
+		case "github." + githubCallUserInfo + ".attempt":
+			attempts = append(attempts, span)
+		}
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("recorded %d attempt spans, want 2", len(attempts))
+	}
+	for i, attempt := range attempts {
+		if attempt.Parent.SpanID() != call.SpanContext.SpanID() {
+			t.Errorf("attempt %d is not a child of the call span", i+1)
+		}
+		if got := spanAttribute(attempt, "github.attempt"); got != []string{"1", "2"}[i] {
+			t.Errorf("attempt %d github.attempt = %s", i+1, got)
+		}
+	}
+	if len(leaked) != 0 {
+		t.Errorf("GitHub received propagation headers: %v", leaked)
+	}
+	if attempts[0].Status.Code.String() != "Error" || attempts[1].Status.Code.String() == "Error" {
+		t.Errorf("attempt statuses = %v, %v, want the first to fail", attempts[0].Status, attempts[1].Status)
+	}
+}
+
+// TestTracingEnabled verifies export is off unless an OTLP endpoint is configured.
+func TestTracingEnabled(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want bool
+	}{
+		{env: map[string]string{}, want: false},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, want: true},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/v1/traces"}, want: true},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SDK_DISABLED": "true"}, want: false},
+		{env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_TRACES_EXPORTER": "none"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tracingEnabled(func(key string) string { return tt.env[key] }); got != tt.want {
+			t.Errorf("tracingEnabled(%v) = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+// TestTracingUsesEgressCA verifies the exporter trusts the egress CA bundle.
+func TestTracingUsesEgressCA(t *testing.T) {
+	exports := make(chan string, 1)
+	collector := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case exports <- r.URL.Path:
+		default:
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(collector.Close)
+	useEgress(t, "", "", "", writeCAFile(t, collector), "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL)
+	useTestTracer(t) // restores the global provider afterwards
+
+	shutdown, err := setupTracing(t.Context())
+	if err != nil {
+		t.Fatalf("setupTracing() error = %v", err)
+	}
+	_, span := otel.Tracer("test").Start(t.Context(), "export")
+	span.End()
+	if err := shutdown(t.Context()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+	select {
+	case path := <-exports:
+		if path != "/v1/traces" {
+			t.Errorf("export path = %q, want /v1/traces", path)
+		}
+	default:
+		t.Error("collector received no spans")
+	}
+}
@@ -4,15 +4,47 @@ addEventListener("fetch", (event) => {
   event.respondWith(handleRequest(event.request, event));
 });
 
+/**
+ * Sign the original host so the server can tell our X-Original-Host from one a
+ * client made up. Must match signOriginalHost in host.go: hex HMAC-SHA256 of
+ * "<host>\n<unix timestamp>".
+ */
+async function signOriginalHost(secret, host, timestamp) {
+  const encoder = new TextEncoder();
+  const key = await crypto.subtle.importKey(
+    "raw",
+    encoder.encode(secret),
+    { name: "HMAC", hash: "SHA-256" },
+    false,
+    ["sign"],
+  );
+  const mac = await crypto.subtle.sign("HMAC", key, encoder.encode(`${host}\n${timestamp}`));
+  return [...new Uint8Array(mac)].map((b) => b.toString(16).padStart(2, "0")).join("");
+}
+
 async function handleRequest(request, event) {
   try {
     const url = new URL(request.url);
     const targetHost = event.env?.TARGET_HOST || "dashboard-919730087582.us-central1.run.app";
+    const secret =
+      event.env?.ORIGINAL_HOST_SECRET ||
+      (typeof ORIGINAL_HOST_SECRET !== "undefined" ? ORIGINAL_HOST_SECRET : "");
     const targetUrl = new URL(url.pathname + url.search, `https://${targetHost}`);
 
-    // Build headers with original hostname
+    // Build headers with the signed original hostname; anything the client
+    // sent under these names is replaced
     const headers = new Headers(request.headers);
     headers.set("X-Original-Host", url.hostname);
+    headers.delete("X-Original-Host-Timestamp");
+    headers.delete("X-Original-Host-Signature");
+    if (secret) {
+      const timestamp = Math.floor(Date.now() / 1000).toString();
+      headers.set("X-Original-Host-Timestamp", timestamp);
+      const signature = await signOriginalHost(secret, url.hostname, timestamp);
+      headers.set("X-Original-Host-Signature", signature);
+    } else {
+      console.error("ORIGINAL_HOST_SECRET is not set; the server will ignore X-Original-Host");
+    }
     headers.set("Host", targetHost);
 
     // Forward the request with the same method and body
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Workspace modes. Subdomain mode serves org workspaces from <org>.<base domain>
+// and needs wildcard DNS and certificates. Path mode serves them from
+// /w/<org>/ on the base domain itself, with OAuth on the same host.
+const (
+	workspaceModeSubdomain = "subdomain"
+	workspaceModePath      = "path"
+	workspacePathPrefix    = "/w/"
+)
+
+// usePathWorkspaces reports whether workspaces live under /w/<org>/.
+func usePathWorkspaces() bool {
+	return *workspaceMode == workspaceModePath
+}
+
+func validateWorkspaceMode(mode string) error {
+	switch mode {
+	case workspaceModeSubdomain, workspaceModePath:
+		return nil
+	default:
+		return fmt.Errorf("workspace mode %q must be %q or %q", mode, workspaceModeSubdomain, workspaceModePath)
+	}
+}
+
+// authHost returns the host that runs the OAuth flow.
+func authHost() string {
+	if usePathWorkspaces() {
+		return *baseDomain
+	}
+	return "auth." + *baseDomain
+}
+
+// workspaceOrigin returns the URL that a workspace's routes are relative to, or
+// the base domain's for the personal workspace.
+func workspaceOrigin(workspace string) string {
+	switch {
+	case workspace == "":
+		return "https://" + *baseDomain
+	case usePathWorkspaces():
+		return "https://" + *baseDomain + strings.TrimSuffix(workspacePathPrefix, "/") + "/" + workspace
+	default:
+		return "https://" + workspace + "." + *baseDomain
+	}
+}
+
+// cutWorkspacePath splits "/w/<org>/rest" into the org and "/rest". rest is
+// empty when the path names the workspace without a trailing slash. The org is
+// not validated.
+func cutWorkspacePath(path string) (org, rest string, ok bool) {
+	after, ok := strings.CutPrefix(path, workspacePathPrefix)
+	if !ok {
+		return "", "", false
+	}
+	org, rest, found := strings.Cut(after, "/")
+	if found {
+		rest = "/" + rest
+	}
+	return org, rest, org != ""
+}
+
+// requestWorkspace returns the org workspace a request was made in and its route
+// within the workspace. The workspace is "" for the personal dashboard.
+func requestWorkspace(r *http.Request) (workspace, route string) {
+	if usePathWorkspaces() {
+		if org, rest, ok := cutWorkspacePath(r.URL.Path); ok && isValidGitHubHandle(org) {
+			return org, rest
+		}
+		return "", r.URL.Path
+	}
+	host := r.Header.Get(originalHostHeader)
+	if host == "" {
+		host = r.Host
+	}
+	return workspaceFromHost(host), r.URL.Path
+}
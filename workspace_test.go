@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// usePathWorkspaceMode serves workspaces from /w/{org}/ on domain for the rest of the test.
+func usePathWorkspaceMode(t *testing.T, domain string) {
+	t.Helper()
+	previous := *workspaceMode
+	t.Cleanup(func() { *workspaceMode = previous })
+	*workspaceMode = workspaceModePath
+	useBaseDomain(t, domain)
+}
+
+// TestPathWorkspaceOAuthFlow verifies OAuth runs on the same host and returns to the workspace path.
+func TestPathWorkspaceOAuthFlow(t *testing.T) {
+	usePathWorkspaceMode(t, "example.test")
+	useFakeGitHub(t, "alice")
+	setupAuthCodeStore(t)
+	handler := securityHeaders(newMux(nil))
+
+	var cookies []*http.Cookie
+	get := func(target string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, http.NoBody)
+		req.Header.Set("X-Forwarded-Proto", "https")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		cookies = append(cookies, rec.Result().Cookies()...)
+		return rec
+	}
+
+	// No hop through an auth subdomain: login goes straight to GitHub
+	returnTo := "https://example.test/w/acme/"
+	rec := get("https://example.test/oauth/login?return_to=" + url.QueryEscape(returnTo))
+	authorize, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || rec.Code != http.StatusFound || !strings.HasPrefix(authorize.String(), githubURL) {
+		t.Fatalf("login redirect = %d %q, want GitHub authorize", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := authorize.Query().Get("redirect_uri"); got != "https://example.test/oauth/callback" {
+		t.Errorf("redirect_uri = %q, want the same-host callback", got)
+	}
+
+	rec = get("https://example.test/oauth/callback?code=gh-code&state=" + url.QueryEscape(authorize.Query().Get("state")))
+	location := rec.Header().Get("Location")
+	if destination, code, _ := strings.Cut(location, "#auth_code="); destination != returnTo || code == "" {
+		t.Fatalf("callback redirect = %d %q, want %s#auth_code=...", rec.Code, location, returnTo)
+	}
+}
+
+// TestPathWorkspaceReturnTo verifies return targets must be workspace paths on the base domain.
+func TestPathWorkspaceReturnTo(t *testing.T) {
+	usePathWorkspaceMode(t, "example.test")
+
+	tests := []struct {
+		returnTo string
+		valid    bool
+	}{
+		{"https://example.test/", true},
+		{"https://example.test/w/acme/", true},
+		{"https://example.test/w/acme/changelog/bob", true},
+		{"https://example.test/changelog", true},
+		{"https://acme.example.test/", false},
+		{"https://auth.example.test/", false},
+		{"https://example.test/w/-evil/", false},
+		{"https://example.test/w/xn--80ak6aa92e/", false},
+		{"https://example.test.evil.com/w/acme/", false},
+		{"javascript://example.test/w/acme/", false},
+	}
+	for _, tt := range tests {
+		if got := validateReturnToURL(tt.returnTo); (got != "") != tt.valid {
+			t.Errorf("validateReturnToURL(%q) = %q, want valid=%v", tt.returnTo, got, tt.valid)
+		}
+	}
+}
+
+// TestPathWorkspaceSPAFallback verifies every workspace prefix serves the dashboard.
+func TestPathWorkspaceSPAFallback(t *testing.T) {
+	usePathWorkspaceMode(t, "example.test")
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		serveStaticFiles(rec, httptest.NewRequest(http.MethodGet, target, http.NoBody))
+		return rec
+	}
+
+	rec := serve("https://example.test/w/acme?demo=true")
+	if got := rec.Header().Get("Location"); rec.Code != http.StatusMovedPermanently || got != "/w/acme/?demo=true" {
+		t.Errorf("/w/acme = %d %q, want redirect to /w/acme/?demo=true", rec.Code, got)
+	}
+
+	index := string(staticAssets.Load().assets["index.html"].data)
+	for _, path := range []string{"/w/acme/", "/w/acme/robots", "/w/acme/u/alice"} {
+		rec := serve("https://example.test" + path)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<body") {
+			t.Errorf("%s = %d, want index.html", path, rec.Code)
+		}
+		if path == "/w/acme/" && rec.Body.String() != index {
+			t.Errorf("%s did not serve the plain index.html", path)
+		}
+	}
+
+	rec = serve("https://example.test/w/acme/changelog")
+	for _, want := range []string{
+		`<meta property="og:url" content="https://example.test/w/acme/changelog" />`,
+		`<meta property="og:title" content="acme changelog · Ready To Review" />`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("workspace share page missing %s", want)
+		}
+	}
+
+	if rec := serve("https://example.test/w/-evil/"); rec.Code != http.StatusNotFound {
+		t.Errorf("invalid workspace status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serve("https://example.test/assets/missing.js"); rec.Code != http.StatusNotFound {
+		t.Errorf("missing asset status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = httptest.NewRecorder()
+	handleClientConfig(rec, httptest.NewRequest(http.MethodGet, clientConfigPath, http.NoBody))
+	if body := rec.Body.String(); !strings.Contains(body, `"workspace_mode":"path"`) || !strings.Contains(body, `"auth_host":"example.test"`) {
+		t.Errorf("config = %s, want path mode on example.test", body)
+	}
+}